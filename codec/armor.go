@@ -0,0 +1,145 @@
+package codec
+
+import (
+	"errors"
+	"strings"
+)
+
+const (
+	armorBegin   = "-----BEGIN SODA MESSAGE-----"
+	armorEnd     = "-----END SODA MESSAGE-----"
+	armorVersion = "1"
+
+	// ArmorWidth is how many characters each line of an armored body has.
+	ArmorWidth = 64
+)
+
+// Armor encodes p with c and wraps it in BEGIN and END lines, with headers
+// and fixed width lines, so that it can be found again in an email or a forum
+// post, like
+//     -----BEGIN SODA MESSAGE-----
+//     Version: 1
+//     Codec: ASCII
+//
+//     ~Uq7>W2nD/w@c*F..
+//     -----END SODA MESSAGE-----
+func Armor(c Codec, p []byte) string {
+	var ret strings.Builder
+	ret.WriteString(armorBegin + "\n")
+	ret.WriteString("Version: " + armorVersion + "\n")
+	ret.WriteString("Codec: " + c.Name() + "\n\n")
+
+	n := 0
+	for _, r := range c.Encode(p) {
+		ret.WriteRune(r)
+		if n++; n == ArmorWidth {
+			ret.WriteByte('\n')
+			n = 0
+		}
+	}
+	if n > 0 {
+		ret.WriteByte('\n')
+	}
+	ret.WriteString(armorEnd + "\n")
+
+	return ret.String()
+}
+
+// isArmored reports whether s has an armored block in it.
+func isArmored(s string) bool {
+	return strings.Contains(s, armorBegin)
+}
+
+// dearmor finds the first armored block in s, ignoring whatever is around it,
+// and decodes it. Whatever comes before the BEGIN line on the same line is
+// taken off every line of the block. If it is the "> " of a quote in an email,
+// as many levels of quoting are taken off instead, so that the blank lines
+// quoted as a bare ">" are blank again.
+func dearmor(s string) ([]byte, error) {
+	i := strings.Index(s, armorBegin)
+	lineStart := strings.LastIndexByte(s[:i], '\n') + 1
+	prefix := s[lineStart:i]
+	depth := quoteDepth(prefix)
+
+	lines := strings.Split(s[i+len(armorBegin):], "\n")
+	for j, line := range lines {
+		line = strings.TrimRight(line, "\r")
+		if depth > 0 {
+			lines[j] = unquote(line, depth)
+		} else {
+			lines[j] = strings.TrimPrefix(line, prefix)
+		}
+	}
+	// The rest of the BEGIN line
+	lines = lines[1:]
+
+	// Headers, up to a blank line
+	var version, name string
+	for len(lines) > 0 {
+		line := strings.TrimSpace(lines[0])
+		lines = lines[1:]
+		if line == "" {
+			break
+		}
+
+		kv := strings.SplitN(line, ":", 2)
+		if len(kv) != 2 {
+			return nil, errors.New("armor: bad header")
+		}
+		switch strings.TrimSpace(kv[0]) {
+		case "Version":
+			version = strings.TrimSpace(kv[1])
+		case "Codec":
+			name = strings.TrimSpace(kv[1])
+		}
+	}
+
+	if version != armorVersion {
+		return nil, errors.New("armor: unsupported version " + version + ", please upgrade soda")
+	}
+	c, ok := Lookup(name)
+	if !ok {
+		return nil, errors.New("armor: unknown codec " + name)
+	}
+
+	// Body, up to the END line
+	var body strings.Builder
+	for _, line := range lines {
+		if strings.TrimSpace(line) == armorEnd {
+			filtered := spaces.ReplaceAllString(body.String(), "")
+			if !c.Detect(filtered) {
+				return nil, errors.New("armor: the body is not " + name)
+			}
+
+			return c.Decode(filtered)
+		}
+		body.WriteString(line)
+	}
+
+	return nil, errors.New("armor: no END line, the text may be incomplete")
+}
+
+// quoteDepth returns how many levels of email quoting prefix is, or 0 if it
+// is not made of quote markers only.
+func quoteDepth(prefix string) int {
+	if strings.Trim(prefix, "> \t") != "" {
+		return 0
+	}
+
+	return strings.Count(prefix, ">")
+}
+
+// unquote takes depth levels of quoting off line, each a ">" which may be
+// followed by a space. Only those levels are taken off, as the body itself
+// may begin with a ">".
+func unquote(line string, depth int) string {
+	for ; depth > 0; depth-- {
+		line = strings.TrimLeft(line, " \t")
+		if !strings.HasPrefix(line, ">") {
+			break
+		}
+		line = strings.TrimPrefix(line[1:], " ")
+	}
+
+	return line
+}
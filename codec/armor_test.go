@@ -0,0 +1,110 @@
+package codec
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// quote quotes s as a mail client would, with prefix in front of every line,
+// and bare for the blank ones.
+func quote(s, prefix, bare string) string {
+	lines := strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+	for i, line := range lines {
+		if line == "" {
+			lines[i] = bare
+		} else {
+			lines[i] = prefix + line
+		}
+	}
+
+	return strings.Join(lines, "\n") + "\n"
+}
+
+func mustDecode(t *testing.T, s string, want []byte) {
+	t.Helper()
+
+	got, err := Decode(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Fatalf("got %x, want %x", got, want)
+	}
+}
+
+func TestArmor(t *testing.T) {
+	p := make([]byte, 300)
+	for i := range p {
+		p[i] = byte(i * 31)
+	}
+
+	for _, c := range []Codec{Base91, Emoji} {
+		armored := Armor(c, p)
+		for _, line := range strings.Split(armored, "\n") {
+			if n := len([]rune(line)); n > ArmorWidth && !strings.HasPrefix(line, "-----") {
+				t.Fatalf("%s: a line of %d characters", c.Name(), n)
+			}
+		}
+
+		mustDecode(t, armored, p)
+		mustDecode(t, "Hi,\n\nhere it is:\n"+armored+"\nBye.\n", p)
+		mustDecode(t, strings.Replace(armored, "\n", "\r\n", -1), p)
+		mustDecode(t, quote(armored, "    ", ""), p)
+
+		if _, err := Decode(armored[:len(armored)-len(armorEnd)-2]); err == nil {
+			t.Fatalf("%s: a block without the END line is decoded", c.Name())
+		}
+	}
+}
+
+func TestArmorQuoted(t *testing.T) {
+	p := []byte("hello, world")
+	armored := Armor(Base91, p)
+
+	for _, quoted := range []string{
+		quote(armored, "> ", "> "),
+		quote(armored, "> ", ">"),
+		quote(armored, ">", ">"),
+		quote(quote(armored, "> ", ">"), "> ", ">"),
+		quote(quote(armored, "> ", ">"), ">", ">"),
+		strings.Replace(quote(armored, "> ", ">"), "\n", "\r\n", -1),
+	} {
+		mustDecode(t, "On Monday, Alice wrote:\n"+quoted+"\nThanks!\n", p)
+	}
+}
+
+// Only the quoting is taken off a quoted body line, not the ">" it may begin
+// with.
+func TestArmorQuotedBody(t *testing.T) {
+	for i := 0; i < 1000; i++ {
+		p := make([]byte, 200)
+		for j := range p {
+			p[j] = byte(i*j + j*j*7)
+		}
+		armored := Armor(Base91, p)
+		if !strings.Contains(armored, "\n>") {
+			continue
+		}
+
+		mustDecode(t, quote(armored, "> ", ">"), p)
+		return
+	}
+
+	t.Fatal("no body line begins with >")
+}
+
+func TestArmorBad(t *testing.T) {
+	armored := Armor(Base91, []byte("hello"))
+
+	for _, bad := range []string{
+		strings.Replace(armored, "Version: "+armorVersion, "Version: 99", 1),
+		strings.Replace(armored, "Codec: ASCII", "Codec: Nope", 1),
+		strings.Replace(armored, "Codec: ASCII", "Codec: Emoji", 1),
+		strings.Replace(armored, "Version: ", "Version ", 1),
+	} {
+		if _, err := Decode(bad); err == nil {
+			t.Fatalf("decoded %q", bad)
+		}
+	}
+}
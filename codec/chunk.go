@@ -0,0 +1,127 @@
+package codec
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// A part begins a line with its index, the total and the ID of the whole text.
+var chunkHeader = regexp.MustCompile(`(?m)^[ \t>]*(\d+)/(\d+) ([0-9a-f]{6}) (\S+)`)
+
+// Split splits an encoded text into numbered parts of at most budget
+// characters each, for channels that only take so much at a time, like
+//     1/3 5e0c2a ~Uq7>W2nD/w@c*F..
+// where 5e0c2a is the ID of the whole text, a digest of it, which tells the
+// parts of different texts apart and checks that they fit together. Spaces
+// are removed first, so an armored text can't be split.
+func Split(s string, budget int) ([]string, error) {
+	if strings.Contains(s, armorBegin) {
+		return nil, errors.New("codec: armored text can't be split")
+	}
+
+	runes := []rune(spaces.ReplaceAllString(s, ""))
+	id := chunkID(string(runes))
+
+	// Find how many parts it takes, as the header grows with the count.
+	n := 1
+	room := 0
+	for {
+		room = budget - len(chunkPrefix(n, n, id))
+		if room <= 0 {
+			return nil, errors.New("codec: too few characters for a part")
+		}
+		if (len(runes)+room-1)/room <= n {
+			break
+		}
+		n++
+	}
+
+	parts := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		end := (i + 1) * room
+		if end > len(runes) {
+			end = len(runes)
+		}
+		parts = append(parts, chunkPrefix(i+1, n, id)+string(runes[i*room:end]))
+	}
+
+	return parts, nil
+}
+
+// Chunks collects the parts made by Split, in any order, until the whole text
+// is there.
+type Chunks struct {
+	id    string
+	total int
+	parts map[int]string
+}
+
+// Add adds every part found in s, ignoring whatever is around them. It
+// returns false if there are none.
+func (c *Chunks) Add(s string) (bool, error) {
+	matches := chunkHeader.FindAllStringSubmatch(s, -1)
+	if len(matches) == 0 {
+		return false, nil
+	}
+
+	for _, m := range matches {
+		i, err1 := strconv.Atoi(m[1])
+		total, err2 := strconv.Atoi(m[2])
+		if err1 != nil || err2 != nil || total == 0 || i == 0 || i > total {
+			return true, errors.New("codec: bad part number " + m[1] + "/" + m[2])
+		}
+
+		if c.parts == nil {
+			c.id = m[3]
+			c.total = total
+			c.parts = make(map[int]string)
+		}
+		if m[3] != c.id || total != c.total {
+			return true, errors.New("codec: the part " + m[1] + "/" + m[2] + " belongs to another message")
+		}
+		if old, ok := c.parts[i]; ok && old != m[4] {
+			return true, errors.New("codec: two different parts " + m[1] + "/" + m[2])
+		}
+
+		c.parts[i] = m[4]
+	}
+
+	return true, nil
+}
+
+// Count returns how many parts are there, out of how many.
+func (c *Chunks) Count() (int, int) {
+	return len(c.parts), c.total
+}
+
+// Join returns the whole text once all parts are there.
+func (c *Chunks) Join() (string, error) {
+	if c.parts == nil || len(c.parts) != c.total {
+		return "", errors.New("codec: some parts are missing")
+	}
+
+	var ret strings.Builder
+	for i := 1; i <= c.total; i++ {
+		ret.WriteString(c.parts[i])
+	}
+
+	if chunkID(ret.String()) != c.id {
+		return "", errors.New("codec: the parts do not fit together")
+	}
+
+	return ret.String(), nil
+}
+
+func chunkPrefix(i, n int, id string) string {
+	return strconv.Itoa(i) + "/" + strconv.Itoa(n) + " " + id + " "
+}
+
+// chunkID is the first 3 bytes of SHA-256 of the text, in hex.
+func chunkID(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:3])
+}
@@ -0,0 +1,112 @@
+package codec
+
+import (
+	"testing"
+)
+
+// payload returns n bytes that do not repeat for a while.
+func payload(n int) []byte {
+	p := make([]byte, n)
+	for i := range p {
+		p[i] = byte(i * 37)
+	}
+
+	return p
+}
+
+func TestSplit(t *testing.T) {
+	p := payload(700)
+	for _, c := range []Codec{Base91, Emoji} {
+		s := c.Encode(p)
+		parts, err := Split(s, 160)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(parts) < 2 {
+			t.Fatalf("%s: got %d parts", c.Name(), len(parts))
+		}
+		for _, part := range parts {
+			if n := len([]rune(part)); n > 160 {
+				t.Fatalf("%s: a part has %d characters", c.Name(), n)
+			}
+		}
+
+		// Backwards, two at a time, one of them quoted
+		chunks := new(Chunks)
+		for i := len(parts) - 1; i >= 0; i -= 2 {
+			text := "> " + parts[i]
+			if i > 0 {
+				text += "\r\n\r\n" + parts[i-1] + "\r\n"
+			}
+			if ok, err := chunks.Add(text); !ok || err != nil {
+				t.Fatalf("%s: got %v, %v", c.Name(), ok, err)
+			}
+		}
+		if have, total := chunks.Count(); have != total || total != len(parts) {
+			t.Fatalf("%s: got %d/%d", c.Name(), have, total)
+		}
+
+		joined, err := chunks.Join()
+		if err != nil {
+			t.Fatal(err)
+		}
+		mustDecode(t, joined, p)
+	}
+}
+
+func TestSplitBad(t *testing.T) {
+	if _, err := Split("~abc", 10); err == nil {
+		t.Fatal("a budget too small for the header is accepted")
+	}
+	if _, err := Split(Armor(Base91, payload(10)), 4000); err == nil {
+		t.Fatal("an armored text is split")
+	}
+}
+
+func TestChunksBad(t *testing.T) {
+	p := payload(300)
+	parts, _ := Split(Base91.Encode(p), 100)
+	other, _ := Split(Base91.Encode(p[:299]), 100)
+
+	if ok, _ := new(Chunks).Add(Base91.Encode(p)); ok {
+		t.Fatal("a whole text is taken as a part")
+	}
+
+	chunks := new(Chunks)
+	if _, err := chunks.Join(); err == nil {
+		t.Fatal("nothing is joined")
+	}
+	chunks.Add(parts[0])
+	if _, err := chunks.Add(other[1]); err == nil {
+		t.Fatal("a part of another message is accepted")
+	}
+	if _, err := chunks.Join(); err == nil {
+		t.Fatal("joined with parts missing")
+	}
+
+	tampered := []byte(parts[0])
+	if tampered[len(tampered)-1] == 'A' {
+		tampered[len(tampered)-1] = 'B'
+	} else {
+		tampered[len(tampered)-1] = 'A'
+	}
+	if _, err := chunks.Add(string(tampered)); err == nil {
+		t.Fatal("two different parts with the same number are accepted")
+	}
+
+	// A tampered part that is on its own does not fit with the rest.
+	chunks = new(Chunks)
+	chunks.Add(string(tampered))
+	for _, part := range parts[1:] {
+		chunks.Add(part)
+	}
+	if _, err := chunks.Join(); err == nil {
+		t.Fatal("a tampered part is joined")
+	}
+
+	for _, bad := range []string{"0/3 abcdef ~x", "4/3 abcdef ~x", "1/0 abcdef ~x"} {
+		if _, err := new(Chunks).Add(bad); err == nil {
+			t.Fatalf("%q is accepted", bad)
+		}
+	}
+}
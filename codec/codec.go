@@ -2,7 +2,9 @@
 package codec // import "ekyu.moe/soda/codec"
 
 import (
+	"errors"
 	"regexp"
+	"strings"
 
 	"ekyu.moe/base256"
 	"ekyu.moe/base91"
@@ -11,14 +13,53 @@ import (
 
 type EncodeFunc func([]byte) string
 
+// Codec turns binary into text that survives copy and paste, and back.
+//
+// Every encoded text begins with the marker of its codec, so that Decode can
+// tell which codec to use without guessing.
+type Codec interface {
+	// Name is how the codec is shown to the user.
+	Name() string
+
+	// Encode encodes p, beginning with the marker.
+	Encode(p []byte) string
+
+	// Decode decodes s, which begins with the marker and has no spaces.
+	Decode(s string) ([]byte, error)
+
+	// Detect reports whether s begins with the marker.
+	Detect(s string) bool
+}
+
 var (
-	Base91Encode   = base91.EncodeToString
-	EmojiEncode    = base256.EncodeToString
-	EmojiTagEncode = encodeEmojiTag
+	// Base91 is basE91, marked with "~".
+	Base91 Codec = &markedCodec{
+		name:   "ASCII",
+		marker: "~",
+		encode: base91.EncodeToString,
+		decode: base91.DecodeString,
+	}
+
+	// Emoji is base256 in emoji, marked with "🍹".
+	Emoji Codec = &markedCodec{
+		name:   "Emoji",
+		marker: "🍹",
+		encode: base256.EncodeToString,
+		decode: base256.DecodeString,
+	}
+
+	// EmojiTag is Emoji written as tags like :pizza:, marked with ":soda:".
+	EmojiTag Codec = &markedCodec{
+		name:   "EmojiTag",
+		marker: ":soda:",
+		encode: encodeEmojiTag,
+		decode: decodeEmojiTag,
+	}
 )
 
 var (
-	nonAscii        = regexp.MustCompile(`[[:^ascii:]]`)
+	registry []Codec
+
 	spaces          = regexp.MustCompile(`[[:space:]]`)
 	emojiToTagSheet = make(map[string]string)
 )
@@ -28,26 +69,109 @@ func init() {
 	for i, v := range emoji.CodeMap() {
 		emojiToTagSheet[v] = i
 	}
+
+	Register(Base91)
+	Register(Emoji)
+	Register(EmojiTag)
+	Register(Words)
 }
 
-func encodeEmojiTag(p []byte) string {
-	raw := base256.EncodeToString(p)
+// Register adds a codec, which is then offered to the user and used by
+// Decode. It panics if the name is taken, or if one marker is a prefix of
+// another, which would make them ambiguous.
+func Register(c Codec) {
+	for _, v := range registry {
+		if v.Name() == c.Name() {
+			panic("codec: " + c.Name() + " is registered twice")
+		}
 
-	ret := ""
-	for _, v := range raw {
-		ret += emojiToTagSheet[string(v)]
+		// Encoding nothing gives the bare marker.
+		if v.Detect(c.Encode(nil)) || c.Detect(v.Encode(nil)) {
+			panic("codec: the markers of " + v.Name() + " and " + c.Name() + " are ambiguous")
+		}
 	}
 
-	return ret
+	registry = append(registry, c)
 }
 
-func DetectCodecAndDecode(s string) []byte {
+// Codecs returns the registered codecs, in the order they are registered.
+func Codecs() []Codec {
+	return append([]Codec(nil), registry...)
+}
+
+// Lookup finds a registered codec by name.
+func Lookup(name string) (Codec, bool) {
+	for _, c := range registry {
+		if c.Name() == name {
+			return c, true
+		}
+	}
+
+	return nil, false
+}
+
+// Decode finds the codec by the marker and decodes s with it. Spaces are
+// ignored, as they are often added by whatever the text has been through.
+//
+// If s has an armored block made by Armor in it, only that block is decoded,
+// and the text around it is ignored.
+func Decode(s string) ([]byte, error) {
+	if isArmored(s) {
+		return dearmor(s)
+	}
+
 	filtered := spaces.ReplaceAllString(s, "")
-	i := emoji.Sprint(filtered)
 
-	if nonAscii.MatchString(i) {
-		return base256.DecodeString(i)
+	for _, c := range registry {
+		if c.Detect(filtered) {
+			return c.Decode(filtered)
+		}
 	}
 
-	return base91.DecodeString(i)
+	return nil, errors.New("codec: unknown encoding, the text may be incomplete")
+}
+
+// markedCodec is a codec that puts a fixed marker in front of the encoded
+// text.
+type markedCodec struct {
+	name   string
+	marker string
+	encode func([]byte) string
+	decode func(string) []byte
+}
+
+func (c *markedCodec) Name() string {
+	return c.name
+}
+
+func (c *markedCodec) Encode(p []byte) string {
+	return c.marker + c.encode(p)
+}
+
+func (c *markedCodec) Decode(s string) ([]byte, error) {
+	if !c.Detect(s) {
+		return nil, errors.New("codec: not " + c.name)
+	}
+
+	return c.decode(s[len(c.marker):]), nil
+}
+
+func (c *markedCodec) Detect(s string) bool {
+	return strings.HasPrefix(s, c.marker)
+}
+
+func encodeEmojiTag(p []byte) string {
+	raw := base256.EncodeToString(p)
+
+	// Key packets can be kilobytes long, don't concat strings one by one.
+	var ret strings.Builder
+	for _, v := range raw {
+		ret.WriteString(emojiToTagSheet[string(v)])
+	}
+
+	return ret.String()
+}
+
+func decodeEmojiTag(s string) []byte {
+	return base256.DecodeString(emoji.Sprint(s))
 }
@@ -0,0 +1,75 @@
+package codec
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestCodecs(t *testing.T) {
+	p := []byte{0, 1, 2, 0x78, 0x9c, 0xfe, 0xff}
+	for _, c := range Codecs() {
+		s := c.Encode(p)
+		if !c.Detect(s) {
+			t.Fatalf("%s: the marker is not detected", c.Name())
+		}
+
+		// Spaces are often added on the way.
+		r := []rune(s)
+		got, err := Decode(" " + string(r[:len(r)/2]) + "\n" + string(r[len(r)/2:]) + " ")
+		if err != nil {
+			t.Fatalf("%s: %v", c.Name(), err)
+		}
+		if !bytes.Equal(got, p) {
+			t.Fatalf("%s: got %x", c.Name(), got)
+		}
+
+		if found, ok := Lookup(c.Name()); !ok || found != c {
+			t.Fatalf("%s is not found", c.Name())
+		}
+	}
+
+	if _, err := Decode("hello"); err == nil {
+		t.Fatal("a text without a marker is decoded")
+	}
+	if _, ok := Lookup("nope"); ok {
+		t.Fatal("an unknown codec is found")
+	}
+}
+
+// Every codec decodes only its own texts.
+func TestCodecsMarker(t *testing.T) {
+	for _, c := range Codecs() {
+		for _, other := range Codecs() {
+			if c != other && c.Detect(other.Encode([]byte("hello"))) {
+				t.Fatalf("%s takes a text of %s", c.Name(), other.Name())
+			}
+		}
+		if _, err := c.Decode("hello"); err == nil {
+			t.Fatalf("%s: a text without the marker is decoded", c.Name())
+		}
+	}
+}
+
+func TestRegister(t *testing.T) {
+	nop := func(p []byte) string { return "" }
+	for _, c := range []Codec{
+		&markedCodec{name: Base91.Name(), marker: "#", encode: nop},
+		&markedCodec{name: "Base91Long", marker: "~x", encode: nop},
+		&markedCodec{name: "Short", marker: ":", encode: nop},
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Fatalf("%s is registered", c.Name())
+				}
+			}()
+			Register(c)
+		}()
+	}
+
+	// A copy, not the registry itself
+	Codecs()[0] = nil
+	if Codecs()[0] == nil {
+		t.Fatal("the registry is changed from outside")
+	}
+}
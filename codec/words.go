@@ -0,0 +1,133 @@
+package codec
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// Words writes each byte as a word of the PGP word list, marked with "soda",
+// so that it can be read aloud over the phone, like
+//     soda
+//     topmost Istanbul Pluto vagabond treadmill Pacific brackish dictator
+// Bytes at even and odd positions take words from different lists, which
+// catches a word left out, said twice or swapped with the next one, and the
+// last two words are a checksum, which catches a word misheard.
+var Words Codec = wordCodec{}
+
+const (
+	wordsMarker   = "soda"
+	wordsPerLine  = 8
+	wordsChecksum = 2
+)
+
+// lowerWords are the lists in lower case, for reading words typed in any case.
+var lowerWords = [2][256]string{lowerWordList(&evenWords), lowerWordList(&oddWords)}
+
+type wordCodec struct{}
+
+func (wordCodec) Name() string {
+	return "Words"
+}
+
+func (wordCodec) Encode(p []byte) string {
+	sum := sha256.Sum256(p)
+	all := append(append([]byte(nil), p...), sum[:wordsChecksum]...)
+
+	var ret strings.Builder
+	ret.WriteString(wordsMarker)
+	for i, b := range all {
+		if i%wordsPerLine == 0 {
+			ret.WriteByte('\n')
+		} else {
+			ret.WriteByte(' ')
+		}
+		if i%2 == 0 {
+			ret.WriteString(evenWords[b])
+		} else {
+			ret.WriteString(oddWords[b])
+		}
+	}
+
+	return ret.String()
+}
+
+func (c wordCodec) Decode(s string) ([]byte, error) {
+	if !c.Detect(s) {
+		return nil, errors.New("codec: not " + c.Name())
+	}
+
+	// Anything but letters, such as hyphens typed between words, is ignored.
+	var letters strings.Builder
+	for _, r := range strings.ToLower(s[len(wordsMarker):]) {
+		if 'a' <= r && r <= 'z' {
+			letters.WriteRune(r)
+		}
+	}
+
+	// The spaces are gone, but no word in a list begins with another one in
+	// the same list, so the words can still be read one by one from the front.
+	rest := letters.String()
+	var all []byte
+	for rest != "" {
+		parity := len(all) % 2
+		b, ok := matchWord(&lowerWords[parity], rest)
+		if !ok {
+			pos := strconv.Itoa(len(all) + 1)
+			if _, ok := matchWord(&lowerWords[1-parity], rest); ok {
+				return nil, errors.New("words: word " + pos + " is out of place, a word may be missing or said twice")
+			}
+			return nil, errors.New("words: word " + pos + " is not in the list, near \"" + abbreviate(rest) + "\"")
+		}
+
+		all = append(all, b)
+		rest = rest[len(lowerWords[parity][b]):]
+	}
+
+	if len(all) < wordsChecksum {
+		return nil, errors.New("words: too few words")
+	}
+
+	p, sum := all[:len(all)-wordsChecksum], all[len(all)-wordsChecksum:]
+	want := sha256.Sum256(p)
+	if !bytes.Equal(sum, want[:wordsChecksum]) {
+		return nil, errors.New("words: checksum mismatch, a word may be wrong")
+	}
+
+	return p, nil
+}
+
+func (wordCodec) Detect(s string) bool {
+	return len(s) >= len(wordsMarker) && strings.EqualFold(s[:len(wordsMarker)], wordsMarker)
+}
+
+// matchWord finds the word in list that s begins with.
+func matchWord(list *[256]string, s string) (byte, bool) {
+	for i, w := range list {
+		if strings.HasPrefix(s, w) {
+			return byte(i), true
+		}
+	}
+
+	return 0, false
+}
+
+func lowerWordList(list *[256]string) [256]string {
+	var ret [256]string
+	for i, w := range list {
+		ret[i] = strings.ToLower(w)
+	}
+
+	return ret
+}
+
+// abbreviate returns the beginning of s, to point out where it goes wrong.
+func abbreviate(s string) string {
+	if len(s) > 16 {
+		return s[:16] + "..."
+	}
+
+	return s
+}
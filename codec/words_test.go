@@ -0,0 +1,68 @@
+package codec
+
+import (
+	"encoding/hex"
+	"strings"
+	"testing"
+)
+
+// The example in the PGP word list paper.
+const wordsSample = "E58294F2E9A227486E8B061B31CC528FD7FA3F19"
+
+func TestWords(t *testing.T) {
+	p, _ := hex.DecodeString(wordsSample)
+	s := Words.Encode(p)
+	if !strings.HasPrefix(s, "soda\ntopmost Istanbul Pluto vagabond treadmill Pacific brackish dictator\ngoldfish Medusa") {
+		t.Fatalf("got %q", s)
+	}
+
+	mustDecode(t, s, p)
+	mustDecode(t, strings.ToUpper(strings.Replace(s, " ", "-", -1)), p)
+	mustDecode(t, Armor(Words, p), p)
+	mustDecode(t, Words.Encode(nil), nil)
+}
+
+// No word in a list begins with another one in the same list, or the words
+// could not be told apart once the spaces are gone.
+func TestWordLists(t *testing.T) {
+	for _, list := range lowerWords {
+		seen := make(map[string]bool)
+		for _, w := range list {
+			if seen[w] {
+				t.Fatalf("%q is in a list twice", w)
+			}
+			seen[w] = true
+
+			for _, other := range list {
+				if w != other && strings.HasPrefix(other, w) {
+					t.Fatalf("%q begins with %q", other, w)
+				}
+			}
+		}
+	}
+}
+
+func TestWordsBad(t *testing.T) {
+	p, _ := hex.DecodeString(wordsSample)
+	s := Words.Encode(p)
+	words := strings.Fields(s)
+
+	for _, bad := range []string{
+		// A word left out
+		strings.Join(append(append([]string(nil), words[:3]...), words[4:]...), " "),
+		// A word said twice
+		strings.Join(append(append([]string(nil), words[:4]...), words[3:]...), " "),
+		// Two words swapped
+		strings.Replace(s, "Pluto vagabond", "vagabond Pluto", 1),
+		// A word misheard as another one in the same list
+		strings.Replace(s, "Pluto", "python", 1),
+		// A typo
+		strings.Replace(s, "Pluto", "plutox", 1),
+		// Only the marker
+		"soda",
+	} {
+		if _, err := Decode(bad); err == nil {
+			t.Fatalf("%q is decoded", bad)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package convey
+
+import (
+	"errors"
+	"image"
+	_ "image/jpeg"
+	_ "image/png"
+	"os"
+	"strings"
+
+	"github.com/makiuchi-d/gozxing"
+	zxingqr "github.com/makiuchi-d/gozxing/qrcode"
+	"github.com/skip2/go-qrcode"
+)
+
+// qrModuleSize is how many pixels a module of a saved QR code takes.
+const qrModuleSize = 8
+
+const (
+	// Black on white whatever the theme of the terminal is, as not every
+	// scanner can read a QR code in reverse.
+	qrLineBegin = "\x1b[30;47m"
+	qrLineEnd   = "\x1b[0m\n"
+)
+
+// QRWrite returns a WriteFunc that shows the text as a QR code on the
+// terminal, so that it can be scanned by a phone. Each character is two
+// modules, one above the other, drawn with half blocks. If path is not empty,
+// the QR code is saved there as a PNG file as well.
+func QRWrite(path string) WriteFunc {
+	return func(text []byte) error {
+		q, err := qrcode.New(string(text), qrcode.Medium)
+		if err != nil {
+			return errors.New("qr: " + err.Error() + ", please choose a shorter codec")
+		}
+
+		// The bitmap has the quiet zone around it already.
+		bitmap := q.Bitmap()
+
+		var ret strings.Builder
+		for y := 0; y < len(bitmap); y += 2 {
+			ret.WriteString(qrLineBegin)
+			for x := range bitmap[y] {
+				top := bitmap[y][x]
+				bottom := y+1 < len(bitmap) && bitmap[y+1][x]
+				switch {
+				case top && bottom:
+					ret.WriteString("█")
+				case top:
+					ret.WriteString("▀")
+				case bottom:
+					ret.WriteString("▄")
+				default:
+					ret.WriteString(" ")
+				}
+			}
+			ret.WriteString(qrLineEnd)
+		}
+
+		if _, err := stdout.Write([]byte(ret.String())); err != nil {
+			return err
+		}
+
+		if path == "" {
+			return nil
+		}
+
+		// A negative size is the size of each module.
+		return q.WriteFile(-qrModuleSize, path)
+	}
+}
+
+// QRRead returns a ReadFunc that decodes the QR code in the PNG or JPEG file
+// at path, such as a photo or a screenshot of one made by QRWrite.
+func QRRead(path string) ReadFunc {
+	return func() ([]byte, error) {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+
+		img, _, err := image.Decode(f)
+		if err != nil {
+			return nil, errors.New("qr: " + err.Error())
+		}
+
+		bmp, err := gozxing.NewBinaryBitmapFromImage(img)
+		if err != nil {
+			return nil, errors.New("qr: " + err.Error())
+		}
+
+		hints := map[gozxing.DecodeHintType]interface{}{
+			gozxing.DecodeHintType_TRY_HARDER:    true,
+			gozxing.DecodeHintType_CHARACTER_SET: "UTF-8",
+		}
+		result, err := zxingqr.NewQRCodeReader().Decode(bmp, hints)
+		if err != nil {
+			return nil, errors.New("qr: no QR code is found in " + path)
+		}
+
+		return []byte(result.GetText()), nil
+	}
+}
@@ -0,0 +1,72 @@
+package convey
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestQR(t *testing.T) {
+	dir, err := ioutil.TempDir("", "soda")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	out := new(bytes.Buffer)
+	defer func(w io.Writer) { stdout = w }(stdout)
+	stdout = out
+
+	path := filepath.Join(dir, "key.png")
+	for _, text := range []string{
+		"~Uq7>W2nD/w@c*F",
+		"🍹" + strings.Repeat("🌀🌁🌂", 30),
+	} {
+		out.Reset()
+		if err := QRWrite(path)([]byte(text)); err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasPrefix(out.String(), qrLineBegin) {
+			t.Fatal("no QR code is shown")
+		}
+
+		got, err := QRRead(path)()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != text {
+			t.Fatalf("got %q, want %q", got, text)
+		}
+	}
+}
+
+func TestQRTooLong(t *testing.T) {
+	defer func(w io.Writer) { stdout = w }(stdout)
+	stdout = ioutil.Discard
+
+	if err := QRWrite("")(bytes.Repeat([]byte("~"), 8000)); err == nil {
+		t.Fatal("a text too long for a QR code is shown")
+	}
+}
+
+func TestQRReadBad(t *testing.T) {
+	if _, err := QRRead(filepath.Join("testdata", "missing.png"))(); err == nil {
+		t.Fatal("a missing file is read")
+	}
+
+	f, err := ioutil.TempFile("", "soda")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	f.WriteString("not an image")
+	f.Close()
+
+	if _, err := QRRead(f.Name())(); err == nil {
+		t.Fatal("a file that is not an image is read")
+	}
+}
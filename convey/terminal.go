@@ -1,8 +1,10 @@
 package convey
 
 import (
+	"fmt"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/mattn/go-colorable"
 )
@@ -13,6 +15,10 @@ var (
 	dimBegin      = []byte("\x1b[90m")
 	dimEnd        = []byte("\x1b[0m\n")
 	newLine       = []byte("\n")
+
+	// Switch to the alternate screen and clear it, and back.
+	altScreenBegin = []byte("\x1b[?1049h\x1b[2J\x1b[H")
+	altScreenEnd   = []byte("\x1b[2J\x1b[?1049l")
 )
 
 // Terminal is write-only.
@@ -37,3 +43,26 @@ func TerminalWrite(text []byte) error {
 
 	return nil
 }
+
+// TerminalBurn returns a WriteFunc like TerminalWrite, except that the text is
+// written to the alternate screen and erased once the countdown is over. The
+// alternate screen keeps the text out of the scrollback.
+func TerminalBurn(countdown time.Duration) WriteFunc {
+	return func(text []byte) error {
+		if _, err := stdout.Write(altScreenBegin); err != nil {
+			return err
+		}
+		defer stdout.Write(altScreenEnd)
+
+		if err := TerminalWrite(text); err != nil {
+			return err
+		}
+
+		for left := countdown; left > 0; left -= time.Second {
+			fmt.Fprintf(stdout, "\r\x1b[KErased in %d s", left/time.Second)
+			time.Sleep(time.Second)
+		}
+
+		return nil
+	}
+}
@@ -0,0 +1,259 @@
+package core
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"errors"
+	"io"
+	"math/big"
+
+	"ekyu.moe/leb128"
+	"github.com/awnumar/memguard"
+	"golang.org/x/crypto/nacl/secretbox"
+	"golang.org/x/crypto/sha3"
+)
+
+const (
+	// A normal message begins with a non-zero seq number, so a zero tells a
+	// broadcast apart.
+	broadcastMarker = 0
+
+	// maxWraps is the maximum number of recipients of a broadcast. Each wrap
+	// costs a recipient a trial decryption, however cheap.
+	maxWraps = 64
+
+	// wrapHeaderSize is the size of the header of a wrap once padded, which
+	// fits the longest message header.
+	wrapHeaderSize = 64
+)
+
+var broadcastInfo = []byte("soda broadcast")
+
+// SealBroadcast seals plain once for several sessions. The plain text is
+// sealed under a random content key, which is then wrapped for each session
+// as a message of its own. On success, the plain text will be destroyed.
+//
+// The header of each wrap, which says which message of the session it is, is
+// encrypted under the broadcast key of the session (see setBroadcastKeys) and
+// padded, so the wraps are random bytes of the same length, shuffled. A
+// recipient learns how many others there are, but not who they are, and finds
+// its own wrap by opening the header of each, which is cheap. Each wrap also
+// carries a digest of the body, so a recipient can't reuse the content key to
+// forge a body for the others.
+//
+// Format:
+//     0x00 + uleb128(count) + (uleb128(len) + wrap)... + nonce[24] + secretbox
+// where each wrap is
+//     nonce[24] + secretbox(len[1] + header + zeros)[64 + 16] + body
+// and header + body is a message sealing
+//     contentKey[32] + SHA3-256(nonce + secretbox)
+func SealBroadcast(sessions []*Session, plain *memguard.LockedBuffer) ([]byte, error) {
+	defer plain.Destroy()
+
+	if len(sessions) == 0 {
+		return nil, errors.New("broadcast: no recipients")
+	}
+	if len(sessions) > maxWraps {
+		return nil, errors.New("broadcast: too many recipients")
+	}
+
+	ck, err := memguard.NewImmutableRandom(32)
+	if err != nil {
+		return nil, err
+	}
+	defer ck.Destroy()
+
+	nonce := new([24]byte)
+	if _, err := io.ReadFull(rand.Reader, nonce[:]); err != nil {
+		return nil, err
+	}
+	body := secretbox.Seal(nonce[:], plain.Buffer(), nonce, array32(ck))
+	digest := sha3.Sum256(body)
+
+	wrapped, err := memguard.NewMutable(64)
+	if err != nil {
+		return nil, err
+	}
+	defer wrapped.Destroy()
+	copy(wrapped.Buffer(), ck.Buffer())
+	copy(wrapped.Buffer()[32:], digest[:])
+
+	wraps := make([][]byte, len(sessions))
+	for i, s := range sessions {
+		if wraps[i], err = s.sealWrap(wrapped.Buffer()); err != nil {
+			return nil, errors.New("broadcast: " + err.Error())
+		}
+	}
+
+	// Fisher-Yates
+	for i := len(wraps) - 1; i > 0; i-- {
+		j, err := rand.Int(rand.Reader, big.NewInt(int64(i+1)))
+		if err != nil {
+			return nil, err
+		}
+		wraps[i], wraps[j.Int64()] = wraps[j.Int64()], wraps[i]
+	}
+
+	ret := []byte{broadcastMarker}
+	ret = leb128.AppendUleb128(ret, uint64(len(wraps)))
+	for _, w := range wraps {
+		ret = leb128.AppendUleb128(ret, uint64(len(w)))
+		ret = append(ret, w...)
+	}
+
+	return append(ret, body...), nil
+}
+
+// sealWrap seals a wrap of a broadcast, holding the lock of the session.
+func (s *Session) sealWrap(wrapped []byte) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.seq == 0 {
+		return nil, errors.New("no shared key")
+	}
+	if s.noise != nil {
+		return nil, errors.New("not supported by a Noise session")
+	}
+
+	payload, err := s.seal(typeWrap, wrapped)
+	if err != nil {
+		return nil, err
+	}
+
+	n, err := s.headerLen(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	header := make([]byte, wrapHeaderSize)
+	header[0] = byte(n)
+	copy(header[1:], payload[:n])
+
+	nonce := new([24]byte)
+	if _, err := io.ReadFull(rand.Reader, nonce[:]); err != nil {
+		return nil, err
+	}
+
+	ret := secretbox.Seal(nonce[:], header, nonce, array32(s.broadcastSend))
+	return append(ret, payload[n:]...), nil
+}
+
+// openBroadcast finds the wrap for this session by opening the header of each
+// of them, then opens the wrap as a message.
+func (s *Session) openBroadcast(payload []byte) (*memguard.LockedBuffer, error) {
+	count, n := leb128.DecodeUleb128(payload[1:])
+	if n == 0 || count == 0 || count > maxWraps {
+		return nil, errors.New("open: bad broadcast")
+	}
+	rest := payload[1+n:]
+
+	var wrap []byte
+	for ; count > 0; count-- {
+		l, n := leb128.DecodeUleb128(rest)
+		if n == 0 || uint64(len(rest)-int(n)) < l {
+			return nil, errors.New("open: bad broadcast")
+		}
+		if wrap == nil {
+			wrap = s.unwrapHeader(rest[n : n+uint(l)])
+		}
+		rest = rest[n+uint(l):]
+	}
+
+	if wrap == nil {
+		return nil, errors.New("open: not a recipient of the broadcast")
+	}
+
+	raw, err := s.open(wrap)
+	if err != nil {
+		return nil, err
+	}
+	if len(raw) != 1+64 || raw[0] != typeWrap {
+		return nil, errors.New("open: bad broadcast wrap")
+	}
+
+	// Wipes the content key in raw
+	ck, err := memguard.NewImmutableFromBytes(raw[1:33])
+	if err != nil {
+		return nil, err
+	}
+	defer ck.Destroy()
+
+	if len(rest) <= 24+secretbox.Overhead {
+		return nil, errors.New("open: bad broadcast")
+	}
+
+	digest := sha3.Sum256(rest)
+	if subtle.ConstantTimeCompare(digest[:], raw[33:]) != 1 {
+		return nil, errors.New("open: broadcast body has been tampered with")
+	}
+
+	nonce := new([24]byte)
+	copy(nonce[:], rest[:24])
+	plain, ok := secretbox.Open(nil, rest[24:], nonce, array32(ck))
+	if !ok {
+		return nil, errors.New("open: authentication failed")
+	}
+
+	return memguard.NewImmutableFromBytes(plain)
+}
+
+// unwrapHeader returns the message in wrap, or nil if wrap is not for this
+// session.
+func (s *Session) unwrapHeader(wrap []byte) []byte {
+	size := 24 + wrapHeaderSize + secretbox.Overhead
+	if len(wrap) <= size {
+		return nil
+	}
+
+	nonce := new([24]byte)
+	copy(nonce[:], wrap)
+	header, ok := secretbox.Open(nil, wrap[24:size], nonce, array32(s.broadcastRecv))
+	if !ok || int(header[0]) >= wrapHeaderSize {
+		return nil
+	}
+
+	return append(header[1:1+header[0]], wrap[size:]...)
+}
+
+// headerLen returns the length of the plain text header of a message.
+func (s *Session) headerLen(payload []byte) (int, error) {
+	_, n, err := parseHeader(payload)
+	return n, err
+}
+
+// setBroadcastKeys derives the keys hiding the headers of broadcast wraps, one
+// for each direction, from the first root key:
+//     broadcastKey := HMAC-SHA256(root, "soda broadcast" + sender)
+// where sender is 'A' for the wraps Alice sends, 'B' for Bob's.
+func (s *Session) setBroadcastKeys(root *memguard.LockedBuffer) error {
+	ours, theirs := byte('B'), byte('A')
+	if s.isAlice {
+		ours, theirs = theirs, ours
+	}
+
+	sendKey, err := broadcastKey(root, ours)
+	if err != nil {
+		return err
+	}
+	recvKey, err := broadcastKey(root, theirs)
+	if err != nil {
+		sendKey.Destroy()
+		return err
+	}
+
+	s.broadcastSend = sendKey
+	s.broadcastRecv = recvKey
+
+	return nil
+}
+
+func broadcastKey(root *memguard.LockedBuffer, sender byte) (*memguard.LockedBuffer, error) {
+	mac := hmac.New(sha256.New, root.Buffer())
+	mac.Write(broadcastInfo)
+	mac.Write([]byte{sender})
+
+	return memguard.NewImmutableFromBytes(mac.Sum(nil))
+}
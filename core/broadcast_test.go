@@ -0,0 +1,167 @@
+package core
+
+import (
+	"bytes"
+	"testing"
+
+	"ekyu.moe/leb128"
+	"github.com/awnumar/memguard"
+)
+
+// newStar returns the sessions of a sender with n recipients, and those of the
+// recipients.
+func newStar(t *testing.T, n int) ([]*Session, []*Session) {
+	t.Helper()
+
+	senders := make([]*Session, n)
+	recipients := make([]*Session, n)
+	for i := range senders {
+		senders[i], recipients[i] = newPair(t)
+	}
+
+	return senders, recipients
+}
+
+func destroySessions(sessions ...[]*Session) {
+	for _, ss := range sessions {
+		for _, s := range ss {
+			s.Destroy()
+		}
+	}
+}
+
+func mustBroadcast(t *testing.T, sessions []*Session, msg string) []byte {
+	t.Helper()
+
+	plain, err := memguard.NewImmutableFromBytes([]byte(msg))
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload, err := SealBroadcast(sessions, plain)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return payload
+}
+
+// splitBroadcast returns the wraps and the body of a broadcast.
+func splitBroadcast(t *testing.T, payload []byte) ([][]byte, []byte) {
+	t.Helper()
+
+	count, n := leb128.DecodeUleb128(payload[1:])
+	rest := payload[1+n:]
+	var wraps [][]byte
+	for ; count > 0; count-- {
+		l, n := leb128.DecodeUleb128(rest)
+		wraps = append(wraps, rest[n:n+uint(l)])
+		rest = rest[n+uint(l):]
+	}
+
+	return wraps, rest
+}
+
+func TestBroadcast(t *testing.T) {
+	senders, recipients := newStar(t, 3)
+	defer destroySessions(senders, recipients)
+
+	payload := mustBroadcast(t, senders, "hello everyone")
+	for _, r := range recipients {
+		mustOpen(t, r, payload, "hello everyone")
+		if _, err := r.Open(payload); err != ErrDuplicate {
+			t.Fatalf("got %v, want ErrDuplicate", err)
+		}
+	}
+
+	// The sessions go on as usual.
+	for i, s := range senders {
+		mustOpen(t, recipients[i], mustSeal(t, s, "hello"), "hello")
+		mustOpen(t, s, mustSeal(t, recipients[i], "hi"), "hi")
+	}
+}
+
+func TestBroadcastOutsider(t *testing.T) {
+	senders, recipients := newStar(t, 2)
+	defer destroySessions(senders, recipients)
+
+	payload := mustBroadcast(t, senders[:1], "not for you")
+	if _, err := recipients[1].Open(payload); err == nil {
+		t.Fatal("an outsider opens a broadcast")
+	}
+	mustOpen(t, recipients[0], payload, "not for you")
+}
+
+func TestBroadcastUnlinkable(t *testing.T) {
+	senders, recipients := newStar(t, 3)
+	defer destroySessions(senders, recipients)
+
+	payload := mustBroadcast(t, senders, "hello everyone")
+
+	// The wraps look alike, and carry none of the plain text header of a
+	// message, such as the ratchet public key of the session.
+	wraps, _ := splitBroadcast(t, payload)
+	for _, w := range wraps {
+		if len(w) != len(wraps[0]) {
+			t.Fatal("wraps differ in length")
+		}
+	}
+	for _, s := range senders {
+		if bytes.Contains(payload, s.ratchetPub[:]) {
+			t.Fatal("a ratchet public key is visible")
+		}
+	}
+}
+
+func TestBroadcastTampered(t *testing.T) {
+	senders, recipients := newStar(t, 2)
+	defer destroySessions(senders, recipients)
+
+	payload := mustBroadcast(t, senders, "hello everyone")
+
+	body := append([]byte(nil), payload...)
+	body[len(body)-1] ^= 0x01
+	for _, r := range recipients {
+		if _, err := r.Open(body); err == nil {
+			t.Fatal("a tampered body is accepted")
+		}
+	}
+
+	// A tampered wrap only fails its own recipient.
+	payload = mustBroadcast(t, senders, "hello again")
+	wraps, _ := splitBroadcast(t, payload)
+	wrap := wraps[0]
+	wrap[len(wrap)-1] ^= 0x01
+	opened := 0
+	for _, r := range recipients {
+		if plain, err := r.Open(payload); err == nil {
+			plain.Destroy()
+			opened++
+		}
+	}
+	if opened != 1 {
+		t.Fatalf("%d recipients open it, want 1", opened)
+	}
+}
+
+func TestBroadcastTooManyWraps(t *testing.T) {
+	senders, recipients := newStar(t, 1)
+	defer destroySessions(senders, recipients)
+
+	many := make([]*Session, maxWraps+1)
+	for i := range many {
+		many[i] = senders[0]
+	}
+	plain, _ := memguard.NewImmutableFromBytes([]byte("hello"))
+	if _, err := SealBroadcast(many, plain); err == nil {
+		t.Fatal("sealed for more than maxWraps recipients")
+	}
+
+	// Claiming more wraps is rejected before any is tried.
+	payload := mustBroadcast(t, senders, "hello")
+	_, n := leb128.DecodeUleb128(payload[1:])
+	forged := append(leb128.AppendUleb128([]byte{broadcastMarker}, maxWraps+1), payload[1+n:]...)
+	if _, err := recipients[0].Open(forged); err == nil {
+		t.Fatal("opened a broadcast of more than maxWraps wraps")
+	}
+	mustOpen(t, recipients[0], payload, "hello")
+}
@@ -0,0 +1,92 @@
+package core
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"errors"
+
+	"github.com/awnumar/memguard"
+)
+
+// ConfirmationSize is the size of a key confirmation tag.
+const ConfirmationSize = 16
+
+var (
+	confirmKeyInfo = []byte("soda key confirmation")
+	confirmAlice   = []byte{'A'}
+	confirmBob     = []byte{'B'}
+)
+
+// Confirmation returns the key confirmation tag to be sent to the partner,
+// which proves that we have computed the same root key:
+//     confirmKey := HMAC-SHA256(root, "soda key confirmation")
+//     tag        := HMAC-SHA256(confirmKey, role + AlicePub + BobPub)[:16]
+// where role is 'A' for Alice and 'B' for Bob, so that a tag can't be
+// reflected back. Everything else exchanged is already bound to the root key.
+//
+// A Noise session has no key confirmation of its own, see StartNoise.
+func (s *Session) Confirmation() ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.noise != nil {
+		return nil, errors.New("confirm: not supported by a Noise session")
+	}
+	if s.confirmKey == nil {
+		return nil, errors.New("confirm: no shared key")
+	}
+
+	return s.confirmationOf(s.isAlice), nil
+}
+
+// VerifyConfirmation checks the partner's key confirmation tag. A mismatch
+// means the partner has computed a different key, either because a key was
+// pasted wrong or because someone is in the middle.
+func (s *Session) VerifyConfirmation(tag []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.noise != nil {
+		return errors.New("confirm: not supported by a Noise session")
+	}
+	if s.confirmKey == nil {
+		return errors.New("confirm: no shared key")
+	}
+
+	if !hmac.Equal(tag, s.confirmationOf(!s.isAlice)) {
+		return errors.New("confirm: keys do not match")
+	}
+
+	// Our tag may still be needed by the partner, but it has been sent
+	// already.
+	s.confirmKey.Destroy()
+	s.confirmKey = nil
+
+	return nil
+}
+
+func (s *Session) confirmationOf(alice bool) []byte {
+	mac := hmac.New(sha256.New, s.confirmKey.Buffer())
+	if alice {
+		mac.Write(confirmAlice)
+	} else {
+		mac.Write(confirmBob)
+	}
+	if s.isAlice {
+		mac.Write(s.pub[:])
+		mac.Write(s.peerPub[:])
+	} else {
+		mac.Write(s.peerPub[:])
+		mac.Write(s.pub[:])
+	}
+
+	return mac.Sum(nil)[:ConfirmationSize]
+}
+
+func deriveConfirmKey(root *memguard.LockedBuffer) (*memguard.LockedBuffer, error) {
+	mac := hmac.New(sha256.New, root.Buffer())
+	mac.Write(confirmKeyInfo)
+
+	// Wipes the source
+	return memguard.NewImmutableFromBytes(mac.Sum(nil))
+}
@@ -0,0 +1,59 @@
+package core
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestConfirmation(t *testing.T) {
+	alice, bob := newPair(t)
+	defer alice.Destroy()
+	defer bob.Destroy()
+
+	tagA, err := alice.Confirmation()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tagB, err := bob.Confirmation()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tagA) != ConfirmationSize || bytes.Equal(tagA, tagB) {
+		t.Fatal("both sides have the same tag")
+	}
+
+	// A tag reflected back is rejected.
+	if err := alice.VerifyConfirmation(tagA); err == nil {
+		t.Fatal("our own tag is accepted")
+	}
+	if err := alice.VerifyConfirmation(tagB); err != nil {
+		t.Fatal(err)
+	}
+	if err := bob.VerifyConfirmation(tagA); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestConfirmationMismatch(t *testing.T) {
+	alice, _ := newPair(t)
+	defer alice.Destroy()
+	_, bob := newPair(t)
+	defer bob.Destroy()
+
+	tag, _ := bob.Confirmation()
+	if err := alice.VerifyConfirmation(tag); err == nil {
+		t.Fatal("a tag of another session is accepted")
+	}
+}
+
+func TestConfirmationNoSharedKey(t *testing.T) {
+	s, _ := NewSession()
+	defer s.Destroy()
+
+	if _, err := s.Confirmation(); err == nil {
+		t.Fatal("a tag before the key exchange")
+	}
+	if err := s.VerifyConfirmation(make([]byte, ConfirmationSize)); err == nil {
+		t.Fatal("a tag is verified before the key exchange")
+	}
+}
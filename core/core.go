@@ -1,33 +1,95 @@
-// Package core is only for internal use and not thread safe.
+// Package core is only for internal use. A Session is safe for concurrent use,
+// though sending and receiving share one lock, see Session. A Group is not.
 package core // import "ekyu.moe/soda/core"
 
 import (
 	"bytes"
 	"encoding/binary"
 	"errors"
-	"unsafe"
+	"math"
+	"sync"
+	"time"
 
-	"ekyu.moe/leb128"
 	"ekyu.moe/util/bytesutil"
 	"github.com/awnumar/memguard"
 	"golang.org/x/crypto/curve25519"
-	"golang.org/x/crypto/nacl/secretbox"
 	"golang.org/x/crypto/salsa20/salsa"
 	"golang.org/x/crypto/sha3"
 )
 
 var (
-	zeros [16]byte
+	zeros          [16]byte
+	zeros32        [32]byte
+	authStringInfo = []byte("soda sas")
 )
 
-// Session holds the key pair, the shared secret, shared nonce seed and seq
-// number. Sensitive data is locked using memguard.
+// Session holds the key pair, the Double Ratchet state, shared nonce seed and
+// seq number. Sensitive data is locked using memguard.
+//
+// Every message is sealed with its own message key, derived from a sending
+// chain that is stepped after each message (the symmetric ratchet). Whenever a
+// message arrives with a new ratchet public key from the partner, a new pair of
+// chains is derived from a fresh X25519 exchange (the DH ratchet). Keys are
+// destroyed as soon as they are used, so a compromise of the session exposes
+// neither past messages nor, after the next round trip, future ones.
+//
+// A Session may be used by several goroutines at once, such as a reader
+// calling Open while a writer calls Seal. Their state is not separate: a DH
+// ratchet step in Open replaces the ratchet key pair and the sending chain
+// that Seal uses. So every method takes the same mutex, and Seal and Open take
+// turns, each holding it for one message.
 type Session struct {
+	mu sync.Mutex
+
 	pub *[32]byte
 	pri *memguard.LockedBuffer
 
-	shared      *memguard.LockedBuffer
-	sharedArray *[32]byte
+	rootKey    *memguard.LockedBuffer
+	confirmKey *memguard.LockedBuffer
+
+	peerPub *[32]byte
+
+	suites []Suite
+	suite  Suite
+
+	// When to ask the partner for a rekey.
+	rekeyMessages  uint64
+	rekeyInterval  time.Duration
+	rekeyRequested bool
+	chainStart     time.Time
+
+	pakeScalar  *memguard.LockedBuffer
+	pakeElement *[32]byte
+
+	kem       *kemState
+	kemDigest *[32]byte
+
+	noise *noiseState
+
+	ratchetPub *[32]byte
+	ratchetPri *memguard.LockedBuffer
+	remotePub  *[32]byte
+
+	sendChain *memguard.LockedBuffer
+	recvChain *memguard.LockedBuffer
+	sendN     uint64
+	recvN     uint64
+	prevN     uint64
+
+	// Set on an imported session whose sending chain was left out of the
+	// state, see Export. Nothing is sealed until the partner steps the DH
+	// ratchet.
+	awaitingStep bool
+
+	skipped *skippedKeys
+
+	// The highest seq number decrypted, and those below it that are not.
+	recvSeq uint64
+	missing map[uint64]struct{}
+
+	// Keys hiding the headers of broadcast wraps, see SealBroadcast.
+	broadcastSend *memguard.LockedBuffer
+	broadcastRecv *memguard.LockedBuffer
 
 	nonceSeed *[24]byte
 	seq       uint64
@@ -43,16 +105,22 @@ func NewSession() (*Session, error) {
 		return nil, err
 	}
 
-	priArray := (*[32]byte)(unsafe.Pointer(&pri.Buffer()[0]))
 	pub := new([32]byte)
 
 	// Calculate public key
-	curve25519.ScalarBaseMult(pub, priArray)
+	curve25519.ScalarBaseMult(pub, array32(pri))
 
 	return &Session{
-		pub: pub,
-		pri: pri,
-		seq: 0,
+		pub:    pub,
+		pri:    pri,
+		seq:    0,
+		suites: DefaultSuites,
+
+		rekeyMessages: DefaultRekeyMessages,
+		rekeyInterval: DefaultRekeyInterval,
+
+		skipped: newSkippedKeys(),
+		missing: make(map[uint64]struct{}),
 	}, nil
 }
 
@@ -61,21 +129,64 @@ func (s *Session) PublicKey() *[32]byte {
 }
 
 func (s *Session) Seq() uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 	return s.seq
 }
 
-// Compute computes the shared secret and shared nonce seed. On success, the
-// private key of the session will be destroyed.
+// Compute computes the root key and shared nonce seed from the partner's
+// hello, agrees on the strongest cipher suite both sides offer, and initializes
+// the Double Ratchet.
 //
-// This is how the shared nonce seed is computed on both sides: In big endian,
-// compare Alice's and Bob's public keys. In the case that Alice's public key is
-// greater, then
-//     nonceSeed := SHAKE128(AlicePub + BobPub)[:24]
-// else
-//     nonceSeed := SHAKE128(BobPub + AlicePub)[:24]
-func (s *Session) Compute(pub *[32]byte) error {
+// The root key is HSalsa20 over the X25519 shared secret, like Box does. A
+// session started by StartNoise runs the Noise handshake messages instead.
+func (s *Session) Compute(peer *Hello) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.noise != nil {
+		return errors.New("compute: a Noise session runs the Noise handshake messages instead")
+	}
+
+	pub := peer.Pub
+	if err := s.checkPeer(pub); err != nil {
+		return errors.New("compute: " + err.Error())
+	}
+
+	// Compute shared secret, a low order public key is rejected.
+	shared, err := dh(s.pri, pub)
+	if err != nil {
+		return errors.New("compute: " + err.Error())
+	}
+	defer shared.Destroy()
+
+	// Compute root key
+	root, err := memguard.NewMutable(32)
+	if err != nil {
+		return err
+	}
+
+	salsa.HSalsa20(array32(root), &zeros, array32(shared), &salsa.Sigma)
+
+	if err := root.MakeImmutable(); err != nil {
+		root.Destroy()
+		return errors.New("compute: " + err.Error())
+	}
+
+	if err := s.begin(root, peer); err != nil {
+		return errors.New("compute: " + err.Error())
+	}
+
+	return nil
+}
+
+// checkPeer makes sure a shared secret can be computed against pub.
+func (s *Session) checkPeer(pub *[32]byte) error {
 	if s.seq != 0 {
-		return errors.New("compute: already have shared secret")
+		return errors.New("already have shared secret")
+	}
+	if s.pri == nil {
+		return errors.New("no private key")
 	}
 
 	// We can't let them the same because the calculation of shared nonce seed
@@ -83,32 +194,46 @@ func (s *Session) Compute(pub *[32]byte) error {
 	// keys are the same, even though the ScalarMult doesn't really care about
 	// it.
 	if bytes.Compare(pub[:], s.pub[:]) == 0 {
-		return errors.New("compute: two public keys are the same")
-	}
-
-	// Compute shared secret
-	shared, err := memguard.NewMutable(32)
-	if err != nil {
-		return err
+		return errors.New("two public keys are the same")
 	}
 
-	s.shared = shared
-	s.sharedArray = (*[32]byte)(unsafe.Pointer(&s.shared.Buffer()[0]))
-	priArray := (*[32]byte)(unsafe.Pointer(&s.pri.Buffer()[0]))
+	return nil
+}
 
-	curve25519.ScalarMult(s.sharedArray, priArray, pub)
-	salsa.HSalsa20(s.sharedArray, &zeros, s.sharedArray, &salsa.Sigma)
+// begin takes the root key, agrees on the cipher suite, computes the shared
+// nonce seed and initializes the Double Ratchet, no matter how the root key is
+// agreed on. The root key is destroyed on failure.
+//
+// Bob keeps his session key pair as his first ratchet key pair and starts
+// sending on a chain derived from the root key alone, while Alice steps the DH
+// ratchet against Bob's public key on her first Seal. Alice's private key is
+// destroyed on success, Bob's is destroyed on the first DH ratchet step.
+//
+// This is how the shared nonce seed is computed on both sides: In big endian,
+// compare Alice's and Bob's public keys. In the case that Alice's public key is
+// greater, then
+//     nonceSeed := SHAKE128(AlicePub + BobPub)[:24]
+// else
+//     nonceSeed := SHAKE128(BobPub + AlicePub)[:24]
+func (s *Session) begin(root *memguard.LockedBuffer, peer *Hello) error {
+	pub := peer.Pub
 
-	if err := s.shared.MakeImmutable(); err != nil {
-		s.shared.Destroy()
-		s.shared = nil
-		s.sharedArray = nil
-		return errors.New("compute: " + err.Error())
+	if (s.kem == nil) != (peer.KEM == nil) {
+		root.Destroy()
+		return errors.New("only one side is using a hybrid key exchange")
 	}
 
-	// Destroy private key
-	s.pri.Destroy()
-	s.pri = nil
+	// Agree on the cipher suite. A partner who offers nothing only knows
+	// secretbox.
+	theirs := peer.Suites
+	if len(theirs) == 0 {
+		theirs = DefaultSuites
+	}
+	suite, err := negotiate(s.suites, theirs)
+	if err != nil {
+		root.Destroy()
+		return err
+	}
 
 	// Compute shared nonce seed.
 	seeder := make([]byte, 64)
@@ -132,56 +257,293 @@ L1:
 		}
 	}
 
+	// Mix in the ML-KEM secrets
+	if s.kem != nil {
+		combined, digest, err := s.kem.combine(root, s.isAlice)
+		root.Destroy()
+		if err != nil {
+			return err
+		}
+		root = combined
+		s.kemDigest = digest
+	}
+
+	// Bind the offered suites to the root key
+	alice, bob := s.suites, theirs
+	if !s.isAlice {
+		alice, bob = bob, alice
+	}
+	bound, err := bindSuites(root, alice, bob)
+	root.Destroy()
+	if err != nil {
+		return err
+	}
+
+	confirmKey, err := deriveConfirmKey(bound)
+	if err != nil {
+		bound.Destroy()
+		return err
+	}
+
+	// The chain Bob sends on until the first DH ratchet step, which is also
+	// Alice's first receiving chain.
+	chain, err := initialChain(bound)
+	if err != nil {
+		bound.Destroy()
+		confirmKey.Destroy()
+		return err
+	}
+
+	if err := s.setBroadcastKeys(bound); err != nil {
+		bound.Destroy()
+		confirmKey.Destroy()
+		chain.Destroy()
+		return err
+	}
+
 	// Here we go
 	sha3.ShakeSum128(s.nonceSeed[:], seeder)
+	s.rootKey = bound
+	s.confirmKey = confirmKey
+	s.peerPub = pub
+	s.suite = suite
+
+	if s.isAlice {
+		// Destroy private key, the ratchet key pair is generated on Seal.
+		s.pri.Destroy()
+		s.remotePub = pub
+		s.recvChain = chain
+	} else {
+		s.ratchetPub = s.pub
+		s.ratchetPri = s.pri
+		s.sendChain = chain
+		s.chainStart = time.Now()
+	}
+	s.pri = nil
+	if s.kem != nil {
+		s.kem.destroy()
+		s.kem = nil
+	}
 	s.seq = 1
 
 	return nil
 }
 
+// AuthString returns the short authentication string of the session, which
+// both sides should compare over another channel, such as a voice call, to
+// make sure nobody is in the middle. It depends on both public keys only, so it
+// is not a secret.
+//     sas := SHA3-256("soda sas" + AlicePub + BobPub)[:5]
+// In a hybrid key exchange, a digest of both encapsulation keys is appended to
+// the input as well.
+//
+// 40 bits are only enough if the hellos are committed to before they are
+// exchanged, see Commit. Someone in the middle then has to pick his keys
+// before he sees ours, and gets through unnoticed with a chance of 2^-40 per
+// handshake. Without the commitments he could see both our keys first, then
+// search for a pair of his own that gives both sides the same string, which
+// only takes about 2^20 tries.
+//
+// A Noise session has a longer one of its own, see noiseAuthString.
+func (s *Session) AuthString() []byte {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.noise != nil {
+		if s.seq == 0 {
+			return nil
+		}
+		return s.noiseAuthString()
+	}
+	if s.peerPub == nil {
+		return nil
+	}
+
+	h := sha3.New256()
+	h.Write(authStringInfo)
+	if s.isAlice {
+		h.Write(s.pub[:])
+		h.Write(s.peerPub[:])
+	} else {
+		h.Write(s.peerPub[:])
+		h.Write(s.pub[:])
+	}
+	if s.kemDigest != nil {
+		h.Write(s.kemDigest[:])
+	}
+
+	return h.Sum(nil)[:5]
+}
+
+// Destroy destroys all the keys held by the session. The session can no longer
+// be used afterwards.
+func (s *Session) Destroy() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, b := range []*memguard.LockedBuffer{
+		s.pri, s.pakeScalar, s.rootKey, s.confirmKey, s.ratchetPri, s.sendChain,
+		s.recvChain, s.broadcastSend, s.broadcastRecv,
+	} {
+		if b != nil {
+			b.Destroy()
+		}
+	}
+	s.skipped.destroy()
+	if s.kem != nil {
+		s.kem.destroy()
+		s.kem = nil
+	}
+	if s.noise != nil {
+		s.noise.destroy()
+		s.noise = nil
+	}
+
+	s.pri = nil
+	s.pakeScalar = nil
+	s.rootKey = nil
+	s.confirmKey = nil
+	s.ratchetPri = nil
+	s.sendChain = nil
+	s.recvChain = nil
+	s.seq = 0
+}
+
 // Seal encrypts and authenticates the plain text.
 // On success, the plain text will be destroyed and return the header+ciphertext.
 func (s *Session) Seal(plain *memguard.LockedBuffer) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
 	if s.seq == 0 {
 		return nil, errors.New("seal: no shared key")
 	}
 
 	defer plain.Destroy()
 
-	// Generate nonce
-	nonce := computeNounce(s.nonceSeed, s.seq, s.isAlice)
+	return s.seal(typeData, plain.Buffer())
+}
+
+// seal seals typ + body, body is empty for control messages.
+func (s *Session) seal(typ byte, body []byte) ([]byte, error) {
+	// The nonce is computed from seq, which must never wrap.
+	if s.seq == math.MaxUint64 {
+		return nil, errors.New("seal: seq number exhausted, please start a new session")
+	}
+
+	if s.noise != nil {
+		return s.sealNoise(typ, body)
+	}
+
+	if s.awaitingStep {
+		return nil, ErrAwaitingPartner
+	}
+
+	// Step the DH ratchet if we have no sending chain yet
+	if s.sendChain == nil {
+		if err := s.ratchetSend(); err != nil {
+			return nil, errors.New("seal: " + err.Error())
+		}
+	}
+
+	// Step the symmetric ratchet
+	mk, next, err := kdfChain(s.sendChain)
+	if err != nil {
+		return nil, errors.New("seal: " + err.Error())
+	}
+	defer mk.Destroy()
+
+	s.sendChain.Destroy()
+	s.sendChain = next
 
 	// Encode header
-	header := leb128.AppendUleb128(nil, s.seq)
+	header := (&header{
+		seq: s.seq,
+		pub: s.ratchetPub,
+		pn:  s.prevN,
+		n:   s.sendN,
+	}).marshal()
+
+	key, err := sealKey(mk, header)
+	if err != nil {
+		return nil, errors.New("seal: " + err.Error())
+	}
+	defer key.Destroy()
+
+	// Prepend the type
+	plain, err := memguard.NewMutable(1 + len(body))
+	if err != nil {
+		return nil, errors.New("seal: " + err.Error())
+	}
+	defer plain.Destroy()
+	plain.Buffer()[0] = typ
+	copy(plain.Buffer()[1:], body)
+
+	// Generate nonce
+	nonce := s.chainNonce(s.ratchetPub, s.seq, s.isAlice)
 	s.seq++
+	s.sendN++
 
 	// Seal
-	payload := secretbox.Seal(header, plain.Buffer(), nonce, s.sharedArray)
+	payload, err := s.suite.seal(header, array32(key), nonce, plain.Buffer(), header)
+	if err != nil {
+		return nil, errors.New("seal: " + err.Error())
+	}
 
 	return payload, nil
 }
 
-// Open authenticates and decrypts a message.
+// Open authenticates and decrypts a message. Messages may arrive out of order,
+// the keys of skipped messages are kept until they arrive, or until maxSkip
+// newer ones are skipped. A message that has already been decrypted is rejected
+// with ErrDuplicate.
+//
+// A broadcast sealed by SealBroadcast is opened here too.
 func (s *Session) Open(payload []byte) (*memguard.LockedBuffer, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
 	if s.seq == 0 {
 		return nil, errors.New("open: no shared key")
 	}
 
-	// Strip seq header
-	seq, n := leb128.DecodeUleb128(payload)
-	if n == 0 || int(n) >= len(payload) {
-		return nil, errors.New("open: bad seq header")
+	// A Noise transport message is the plain text alone, and may begin with
+	// anything.
+	if s.noise != nil {
+		raw, err := s.openNoise(payload)
+		if err != nil {
+			return nil, err
+		}
+		if len(raw) == 0 {
+			return nil, errors.New("open: empty message")
+		}
+
+		plain, err := memguard.NewImmutableFromBytes(raw)
+		if err != nil {
+			return nil, errors.New("open: " + err.Error())
+		}
+		return plain, nil
 	}
 
-	// Compute nonce
-	nonce := computeNounce(s.nonceSeed, seq, !s.isAlice)
+	if len(payload) > 0 && payload[0] == broadcastMarker {
+		return s.openBroadcast(payload)
+	}
 
-	raw, ok := secretbox.Open(nil, payload[n:], nonce, s.sharedArray)
-	if !ok {
-		return nil, errors.New("open: authentication failed")
+	raw, err := s.open(payload)
+	if err != nil {
+		return nil, err
 	}
 
-	plain, err := memguard.NewImmutableFromBytes(raw)
+	switch {
+	case len(raw) == 1 && raw[0] == typeRekey:
+		return nil, ErrRekeyRequest
+	case len(raw) == 1 && raw[0] == typeRekeyAck:
+		return nil, ErrRekeyAck
+	case len(raw) < 2 || raw[0] != typeData:
+		return nil, errors.New("open: unknown message type")
+	}
+
+	plain, err := memguard.NewImmutableFromBytes(raw[1:])
 	if err != nil {
 		return nil, errors.New("open: " + err.Error())
 	}
@@ -189,6 +551,52 @@ func (s *Session) Open(payload []byte) (*memguard.LockedBuffer, error) {
 	return plain, nil
 }
 
+// open opens a message, returning type + body. The session is only modified
+// if the message is authentic.
+func (s *Session) open(payload []byte) ([]byte, error) {
+	// Strip header
+	h, n, err := parseHeader(payload)
+	if err != nil {
+		return nil, errors.New("open: " + err.Error())
+	}
+	if n >= len(payload) {
+		return nil, errors.New("open: bad seq header")
+	}
+
+	// Reject replays
+	if err := s.checkSeq(h.seq); err != nil {
+		return nil, err
+	}
+
+	// Derive message key
+	p, err := s.receive(h)
+	if err != nil {
+		return nil, errors.New("open: " + err.Error())
+	}
+
+	key, err := sealKey(p.mk, payload[:n])
+	if err != nil {
+		p.discard()
+		return nil, errors.New("open: " + err.Error())
+	}
+	defer key.Destroy()
+
+	// Compute nonce
+	nonce := s.chainNonce(h.pub, h.seq, !s.isAlice)
+
+	raw, ok := s.suite.open(array32(key), nonce, payload[n:], payload[:n])
+	if !ok {
+		p.discard()
+		return nil, errors.New("open: authentication failed")
+	}
+
+	p.commit(s)
+	p.mk.Destroy()
+	s.markSeq(h.seq)
+
+	return raw, nil
+}
+
 // For Alice:
 //     // little endian
 //     nonce := nonceSeed[:8] XOR seq + nonceSeed[8:]
@@ -0,0 +1,189 @@
+package core
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/awnumar/memguard"
+)
+
+// newPair returns two sessions that have exchanged hellos with each other.
+func newPair(t testing.TB) (*Session, *Session) {
+	t.Helper()
+
+	alice, err := NewSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	bob, err := NewSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := computePair(alice, bob); err != nil {
+		t.Fatal(err)
+	}
+
+	return alice, bob
+}
+
+// computePair exchanges the hellos of a and b through the wire format.
+func computePair(a, b *Session) error {
+	helloA, err := ParseHello((&Hello{Pub: a.PublicKey(), Suites: a.Suites()}).Marshal())
+	if err != nil {
+		return err
+	}
+	helloB, err := ParseHello((&Hello{Pub: b.PublicKey(), Suites: b.Suites()}).Marshal())
+	if err != nil {
+		return err
+	}
+
+	if err := a.Compute(helloB); err != nil {
+		return err
+	}
+
+	return b.Compute(helloA)
+}
+
+func mustSeal(t testing.TB, s *Session, msg string) []byte {
+	t.Helper()
+
+	plain, err := memguard.NewImmutableFromBytes([]byte(msg))
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload, err := s.Seal(plain)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return payload
+}
+
+func mustOpen(t testing.TB, s *Session, payload []byte, want string) {
+	t.Helper()
+
+	plain, err := s.Open(payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer plain.Destroy()
+
+	if string(plain.Buffer()) != want {
+		t.Fatalf("got %q, want %q", plain.Buffer(), want)
+	}
+}
+
+func TestSealOpen(t *testing.T) {
+	alice, bob := newPair(t)
+	defer alice.Destroy()
+	defer bob.Destroy()
+
+	if !bytes.Equal(alice.AuthString(), bob.AuthString()) {
+		t.Fatal("auth strings differ")
+	}
+
+	for i := 0; i < 3; i++ {
+		mustOpen(t, bob, mustSeal(t, alice, "hello"), "hello")
+		mustOpen(t, alice, mustSeal(t, bob, "hi"), "hi")
+	}
+}
+
+func TestOpenTampered(t *testing.T) {
+	alice, bob := newPair(t)
+	defer alice.Destroy()
+	defer bob.Destroy()
+
+	payload := mustSeal(t, alice, "hello")
+	for i := range payload {
+		tampered := append([]byte(nil), payload...)
+		tampered[i] ^= 0x01
+		if _, err := bob.Open(tampered); err == nil {
+			t.Fatalf("tampered byte %d is accepted", i)
+		}
+	}
+
+	// A forged message does not corrupt the session.
+	mustOpen(t, bob, payload, "hello")
+}
+
+func TestOpenReplayed(t *testing.T) {
+	alice, bob := newPair(t)
+	defer alice.Destroy()
+	defer bob.Destroy()
+
+	payload := mustSeal(t, alice, "hello")
+	mustOpen(t, bob, payload, "hello")
+	if _, err := bob.Open(payload); err != ErrDuplicate {
+		t.Fatalf("got %v, want ErrDuplicate", err)
+	}
+}
+
+func TestNoSharedKey(t *testing.T) {
+	s, err := NewSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Destroy()
+
+	plain, _ := memguard.NewImmutableFromBytes([]byte("hello"))
+	defer plain.Destroy()
+	if _, err := s.Seal(plain); err == nil {
+		t.Fatal("sealed without a shared key")
+	}
+	if _, err := s.Open([]byte{1, 2, 3}); err == nil {
+		t.Fatal("opened without a shared key")
+	}
+}
+
+func TestAuthString(t *testing.T) {
+	alice, bob := newPair(t)
+	defer alice.Destroy()
+	defer bob.Destroy()
+
+	if len(alice.AuthString()) != 5 || !bytes.Equal(alice.AuthString(), bob.AuthString()) {
+		t.Fatal("auth strings differ")
+	}
+
+	// Mallory in the middle has a session with each of them, and neither
+	// auth string matches.
+	aliceM, malloryA := newPair(t)
+	defer aliceM.Destroy()
+	defer malloryA.Destroy()
+	malloryB, bobM := newPair(t)
+	defer malloryB.Destroy()
+	defer bobM.Destroy()
+	if bytes.Equal(aliceM.AuthString(), bobM.AuthString()) {
+		t.Fatal("auth strings match through someone in the middle")
+	}
+
+	s, _ := NewSession()
+	defer s.Destroy()
+	if s.AuthString() != nil {
+		t.Fatal("an auth string before the key exchange")
+	}
+}
+
+func TestCommit(t *testing.T) {
+	s, _ := NewSession()
+	defer s.Destroy()
+
+	hello := (&Hello{Pub: s.PublicKey(), Suites: s.Suites()}).Marshal()
+	commitment := Commit(hello)
+	if len(commitment) != CommitmentSize || !CheckCommitment(commitment, hello) {
+		t.Fatal("a hello does not match its own commitment")
+	}
+
+	// Another key, or the same key offering other suites
+	other, _ := NewSession()
+	defer other.Destroy()
+	for _, h := range [][]byte{
+		(&Hello{Pub: other.PublicKey(), Suites: s.Suites()}).Marshal(),
+		(&Hello{Pub: s.PublicKey(), Suites: AllSuites()}).Marshal(),
+		hello[:32],
+	} {
+		if CheckCommitment(commitment, h) {
+			t.Fatal("another hello matches the commitment")
+		}
+	}
+}
@@ -0,0 +1,418 @@
+package core
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"io"
+	"sort"
+
+	"ekyu.moe/leb128"
+	"github.com/awnumar/memguard"
+	"golang.org/x/crypto/sha3"
+)
+
+var groupAuthStringInfo = []byte("soda group roster")
+
+// Group is a group conversation using sender keys. Every member has a sending
+// chain and a signing key of its own, called its sender key, and sends it to
+// every other member over their pairwise sessions. A group message is then
+// sealed only once under the sender's chain and signed, so that every member
+// can decrypt it, and nobody can forge one in the name of another member.
+//
+// A sender key is only accepted from a pairwise session, which is already
+// authenticated, so a member is who the pairwise session says they are. To
+// make sure everyone sees the same members, compare AuthString.
+//
+// Unlike a Session, a Group is not safe for concurrent use.
+type Group struct {
+	id *[16]byte
+
+	// Our sender key
+	signPub ed25519.PublicKey
+	signPri *memguard.LockedBuffer
+	chain   *memguard.LockedBuffer
+	n       uint64
+
+	// Keyed by the member's signing public key
+	members map[string]*groupMember
+	skipped *skippedKeys
+}
+
+type groupMember struct {
+	name  string
+	chain *memguard.LockedBuffer
+	n     uint64
+}
+
+// NewGroup creates a new group with a random ID.
+func NewGroup() (*Group, error) {
+	id := new([16]byte)
+	if _, err := io.ReadFull(rand.Reader, id[:]); err != nil {
+		return nil, err
+	}
+
+	return JoinGroup(id)
+}
+
+// JoinGroup creates our side of the group with the given ID, which is sent by
+// whoever has created it.
+func JoinGroup(id *[16]byte) (*Group, error) {
+	g := &Group{
+		id:      id,
+		members: make(map[string]*groupMember),
+		skipped: newSkippedKeys(),
+	}
+
+	if err := g.newSenderKey(); err != nil {
+		return nil, err
+	}
+
+	return g, nil
+}
+
+// ID returns the group ID.
+func (g *Group) ID() *[16]byte {
+	return g.id
+}
+
+// SenderKey returns our sender key, which must be sealed with the pairwise
+// session of every other member and sent to them.
+//
+// Format:
+//     groupID[16] + signingPub[32] + uleb128(n) + chain[32]
+func (g *Group) SenderKey() (*memguard.LockedBuffer, error) {
+	n := leb128.AppendUleb128(nil, g.n)
+
+	ret, err := memguard.NewMutable(16 + 32 + len(n) + 32)
+	if err != nil {
+		return nil, err
+	}
+	buf := ret.Buffer()
+	copy(buf, g.id[:])
+	copy(buf[16:], g.signPub)
+	copy(buf[48:], n)
+	copy(buf[48+len(n):], g.chain.Buffer())
+
+	if err := ret.MakeImmutable(); err != nil {
+		ret.Destroy()
+		return nil, err
+	}
+
+	return ret, nil
+}
+
+// SenderKeyGroup returns the ID of the group a sender key belongs to, so that a
+// new group can be joined before the sender key is added.
+func SenderKeyGroup(senderKey *memguard.LockedBuffer) (*[16]byte, error) {
+	buf := senderKey.Buffer()
+	if len(buf) < 16+32+1+32 {
+		return nil, errors.New("group: bad sender key")
+	}
+
+	id := new([16]byte)
+	copy(id[:], buf)
+
+	return id, nil
+}
+
+// AddMember adds the sender key of a member, which must have been opened with
+// the pairwise session with them. name is how they are called on this side.
+// Adding a new sender key for an existing name replaces the old one.
+func (g *Group) AddMember(name string, senderKey *memguard.LockedBuffer) error {
+	buf := senderKey.Buffer()
+	if len(buf) < 16+32+1+32 || !bytes.Equal(buf[:16], g.id[:]) {
+		return errors.New("group: not a sender key of this group")
+	}
+
+	pub := string(buf[16:48])
+	if pub == string(g.signPub) {
+		return errors.New("group: that is our own sender key")
+	}
+
+	n, l := leb128.DecodeUleb128(buf[48:])
+	if l == 0 || len(buf) != 48+int(l)+32 {
+		return errors.New("group: bad sender key")
+	}
+
+	if m, ok := g.members[pub]; ok && m.name != name {
+		return errors.New("group: sender key already belongs to " + m.name)
+	}
+
+	chain, err := memguard.Trim(senderKey, 48+int(l), 32)
+	if err != nil {
+		return err
+	}
+	if err := chain.MakeImmutable(); err != nil {
+		chain.Destroy()
+		return err
+	}
+
+	g.removeMember(name)
+	g.members[pub] = &groupMember{
+		name:  name,
+		chain: chain,
+		n:     n,
+	}
+
+	return nil
+}
+
+// RemoveMember removes a member. The member still knows our sender key, so a
+// new one is generated, which must be sent to the remaining members again.
+func (g *Group) RemoveMember(name string) error {
+	if !g.removeMember(name) {
+		return errors.New("group: no such member")
+	}
+
+	g.chain.Destroy()
+	g.signPri.Destroy()
+
+	return g.newSenderKey()
+}
+
+// Members returns the names of the other members, sorted.
+func (g *Group) Members() []string {
+	ret := make([]string, 0, len(g.members))
+	for _, m := range g.members {
+		ret = append(ret, m.name)
+	}
+	sort.Strings(ret)
+
+	return ret
+}
+
+// AuthString returns the short authentication string of the group members,
+// which every member should compare, like Session.AuthString.
+//     sas := SHA3-256("soda group roster" + groupID + sortedSigningPubs...)[:5]
+func (g *Group) AuthString() []byte {
+	pubs := []string{string(g.signPub)}
+	for pub := range g.members {
+		pubs = append(pubs, pub)
+	}
+	sort.Strings(pubs)
+
+	h := sha3.New256()
+	h.Write(groupAuthStringInfo)
+	h.Write(g.id[:])
+	for _, pub := range pubs {
+		h.Write([]byte(pub))
+	}
+
+	return h.Sum(nil)[:5]
+}
+
+// Seal encrypts, authenticates and signs the plain text for every member.
+// On success, the plain text will be destroyed.
+//
+// Format:
+//     groupID[16] + signingPub[32] + uleb128(n) + secretbox + signature[64]
+func (g *Group) Seal(plain *memguard.LockedBuffer) ([]byte, error) {
+	defer plain.Destroy()
+
+	mk, next, err := kdfChain(g.chain)
+	if err != nil {
+		return nil, errors.New("group: " + err.Error())
+	}
+	defer mk.Destroy()
+
+	header := append(append([]byte(nil), g.id[:]...), g.signPub...)
+	header = leb128.AppendUleb128(header, g.n)
+
+	key, err := sealKey(mk, header)
+	if err != nil {
+		next.Destroy()
+		return nil, errors.New("group: " + err.Error())
+	}
+	defer key.Destroy()
+
+	g.chain.Destroy()
+	g.chain = next
+	g.n++
+
+	payload, err := Secretbox.seal(header, array32(key), groupNonce(header), plain.Buffer(), nil)
+	if err != nil {
+		return nil, errors.New("group: " + err.Error())
+	}
+
+	// crypto/ed25519 caches the expanded key by its address, which has to be
+	// Go memory, so it signs with a copy that is wiped once done.
+	private := append(ed25519.PrivateKey(nil), g.signPri.Buffer()...)
+	sig := ed25519.Sign(private, payload)
+	for i := range private {
+		private[i] = 0
+	}
+
+	return append(payload, sig...), nil
+}
+
+// Open verifies and decrypts a group message, returning the name of the
+// member who has sent it. Like Session.Open, messages may arrive out of order,
+// the keys of the last maxSkip skipped messages are kept. A message already
+// decrypted, or whose key is no longer kept, is rejected with ErrDuplicate.
+func (g *Group) Open(payload []byte) (string, *memguard.LockedBuffer, error) {
+	if len(payload) < 16+32+1+ed25519.SignatureSize || !bytes.Equal(payload[:16], g.id[:]) {
+		return "", nil, errors.New("group: not a message of this group")
+	}
+
+	pub := string(payload[16:48])
+	m, ok := g.members[pub]
+	if !ok {
+		return "", nil, errors.New("group: message from someone not in the group")
+	}
+
+	signed := payload[:len(payload)-ed25519.SignatureSize]
+	if !ed25519.Verify(ed25519.PublicKey(pub), signed, payload[len(signed):]) {
+		return "", nil, errors.New("group: bad signature")
+	}
+
+	n, l := leb128.DecodeUleb128(signed[48:])
+	if l == 0 || 48+int(l) >= len(signed) {
+		return "", nil, errors.New("group: bad header")
+	}
+	header := signed[:48+int(l)]
+
+	// Derive message key, keeping the keys skipped over
+	idx := skippedIndex{n: n}
+	copy(idx.pub[:], pub)
+	skipped := newSkippedKeys()
+	var mk, next *memguard.LockedBuffer
+	if n < m.n {
+		if mk, ok = g.skipped.get(idx); !ok {
+			return "", nil, ErrDuplicate
+		}
+	} else {
+		if n-m.n > maxSkip {
+			return "", nil, errors.New("group: too many skipped messages")
+		}
+
+		cur, err := memguard.Trim(m.chain, 0, 32)
+		if err != nil {
+			return "", nil, err
+		}
+		for i := m.n; i <= n; i++ {
+			k, nk, err := kdfChain(cur)
+			cur.Destroy()
+			if err != nil {
+				skipped.destroy()
+				return "", nil, errors.New("group: " + err.Error())
+			}
+			if i < n {
+				skipped.add(skippedIndex{pub: idx.pub, n: i}, k)
+			} else {
+				mk = k
+			}
+			cur = nk
+		}
+		next = cur
+	}
+
+	discard := func() {
+		skipped.destroy()
+		if next != nil {
+			mk.Destroy()
+			next.Destroy()
+		}
+	}
+
+	key, err := sealKey(mk, header)
+	if err != nil {
+		discard()
+		return "", nil, errors.New("group: " + err.Error())
+	}
+	defer key.Destroy()
+
+	raw, ok := Secretbox.open(array32(key), groupNonce(header), signed[len(header):], nil)
+	if !ok {
+		discard()
+		return "", nil, errors.New("group: authentication failed")
+	}
+
+	// Commit
+	mk.Destroy()
+	if next == nil {
+		g.skipped.take(idx)
+	} else {
+		g.skipped.merge(skipped)
+		m.chain.Destroy()
+		m.chain = next
+		m.n = n + 1
+	}
+
+	plain, err := memguard.NewImmutableFromBytes(raw)
+	if err != nil {
+		return "", nil, errors.New("group: " + err.Error())
+	}
+
+	return m.name, plain, nil
+}
+
+// Destroy destroys all the keys of the group.
+func (g *Group) Destroy() {
+	g.signPri.Destroy()
+	g.chain.Destroy()
+	for pub, m := range g.members {
+		m.chain.Destroy()
+		delete(g.members, pub)
+	}
+	g.skipped.destroy()
+}
+
+func (g *Group) newSenderKey() error {
+	seed, err := memguard.NewImmutableRandom(ed25519.SeedSize)
+	if err != nil {
+		return err
+	}
+	defer seed.Destroy()
+
+	// NewKeyFromSeed has the private key on the heap, it is moved into locked
+	// memory right away.
+	private := ed25519.NewKeyFromSeed(seed.Buffer())
+	pub := append(ed25519.PublicKey(nil), private[32:]...)
+
+	pri, err := memguard.NewImmutableFromBytes(private)
+	if err != nil {
+		return err
+	}
+
+	chain, err := memguard.NewImmutableRandom(32)
+	if err != nil {
+		pri.Destroy()
+		return err
+	}
+
+	g.signPub = pub
+	g.signPri = pri
+	g.chain = chain
+	g.n = 0
+
+	return nil
+}
+
+func (g *Group) removeMember(name string) bool {
+	for pub, m := range g.members {
+		if m.name != name {
+			continue
+		}
+
+		m.chain.Destroy()
+		delete(g.members, pub)
+		g.skipped.destroyIf(func(i skippedIndex) bool {
+			return string(i.pub[:]) == pub
+		})
+
+		return true
+	}
+
+	return false
+}
+
+// groupNonce derives the nonce from the header. Every message key is only
+// used once, the nonce does not have to be secret or random.
+func groupNonce(header []byte) *[24]byte {
+	nonce := new([24]byte)
+	sha3.ShakeSum128(nonce[:], header)
+
+	return nonce
+}
@@ -0,0 +1,209 @@
+package core
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/awnumar/memguard"
+)
+
+// newGroup returns the groups of members that have all added each other.
+func newGroup(t *testing.T, names ...string) map[string]*Group {
+	t.Helper()
+
+	first, err := NewGroup()
+	if err != nil {
+		t.Fatal(err)
+	}
+	gs := map[string]*Group{names[0]: first}
+	for _, name := range names[1:] {
+		if gs[name], err = JoinGroup(first.ID()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for name := range gs {
+		sendSenderKey(t, gs, name)
+	}
+
+	return gs
+}
+
+// sendSenderKey adds the sender key of name to every other member.
+func sendSenderKey(t *testing.T, gs map[string]*Group, name string) {
+	t.Helper()
+
+	key, err := gs[name].SenderKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer key.Destroy()
+
+	for other, g := range gs {
+		if other == name {
+			continue
+		}
+		if err := g.AddMember(name, key); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func destroyGroup(gs map[string]*Group) {
+	for _, g := range gs {
+		g.Destroy()
+	}
+}
+
+func groupSeal(t *testing.T, g *Group, msg string) []byte {
+	t.Helper()
+
+	plain, err := memguard.NewImmutableFromBytes([]byte(msg))
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload, err := g.Seal(plain)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return payload
+}
+
+func groupOpen(t *testing.T, g *Group, payload []byte, sender, want string) {
+	t.Helper()
+
+	name, plain, err := g.Open(payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer plain.Destroy()
+
+	if name != sender || string(plain.Buffer()) != want {
+		t.Fatalf("got %q from %s, want %q from %s", plain.Buffer(), name, want, sender)
+	}
+}
+
+func TestGroup(t *testing.T) {
+	gs := newGroup(t, "alice", "bob", "carol")
+	defer destroyGroup(gs)
+
+	if !bytes.Equal(gs["alice"].AuthString(), gs["bob"].AuthString()) ||
+		!bytes.Equal(gs["alice"].AuthString(), gs["carol"].AuthString()) {
+		t.Fatal("auth strings differ")
+	}
+	if members := gs["alice"].Members(); len(members) != 2 || members[0] != "bob" || members[1] != "carol" {
+		t.Fatalf("got members %v", members)
+	}
+
+	first := groupSeal(t, gs["alice"], "first")
+	second := groupSeal(t, gs["alice"], "second")
+	reply := groupSeal(t, gs["bob"], "reply")
+
+	groupOpen(t, gs["bob"], second, "alice", "second")
+	groupOpen(t, gs["bob"], first, "alice", "first")
+	groupOpen(t, gs["carol"], first, "alice", "first")
+	groupOpen(t, gs["carol"], reply, "bob", "reply")
+	groupOpen(t, gs["alice"], reply, "bob", "reply")
+
+	if _, _, err := gs["bob"].Open(first); err != ErrDuplicate {
+		t.Fatalf("got %v, want ErrDuplicate", err)
+	}
+}
+
+func TestGroupTampered(t *testing.T) {
+	gs := newGroup(t, "alice", "bob")
+	defer destroyGroup(gs)
+
+	payload := groupSeal(t, gs["alice"], "hello")
+	for i := range payload {
+		tampered := append([]byte(nil), payload...)
+		tampered[i] ^= 0x01
+		if _, _, err := gs["bob"].Open(tampered); err == nil {
+			t.Fatalf("tampered byte %d is accepted", i)
+		}
+	}
+
+	groupOpen(t, gs["bob"], payload, "alice", "hello")
+}
+
+func TestGroupRemoveMember(t *testing.T) {
+	gs := newGroup(t, "alice", "bob", "carol")
+	defer destroyGroup(gs)
+
+	if err := gs["alice"].RemoveMember("carol"); err != nil {
+		t.Fatal(err)
+	}
+	if err := gs["alice"].RemoveMember("carol"); err == nil {
+		t.Fatal("removed a member twice")
+	}
+
+	// Only Bob gets the new sender key.
+	key, _ := gs["alice"].SenderKey()
+	defer key.Destroy()
+	if err := gs["bob"].AddMember("alice", key); err != nil {
+		t.Fatal(err)
+	}
+
+	payload := groupSeal(t, gs["alice"], "without carol")
+	groupOpen(t, gs["bob"], payload, "alice", "without carol")
+	if _, _, err := gs["carol"].Open(payload); err == nil {
+		t.Fatal("a removed member opens a new message")
+	}
+
+	// Carol can't send to Alice any more either.
+	if _, _, err := gs["alice"].Open(groupSeal(t, gs["carol"], "still here")); err == nil {
+		t.Fatal("a message from a removed member is accepted")
+	}
+}
+
+func TestGroupSenderKey(t *testing.T) {
+	gs := newGroup(t, "alice", "bob")
+	defer destroyGroup(gs)
+
+	other, _ := NewGroup()
+	defer other.Destroy()
+
+	key, _ := gs["alice"].SenderKey()
+	defer key.Destroy()
+
+	id, err := SenderKeyGroup(key)
+	if err != nil || *id != *gs["alice"].ID() {
+		t.Fatal("wrong group ID of a sender key")
+	}
+
+	if err := other.AddMember("alice", key); err == nil {
+		t.Fatal("a sender key of another group is added")
+	}
+	if err := gs["alice"].AddMember("me", key); err == nil {
+		t.Fatal("our own sender key is added")
+	}
+	if err := gs["bob"].AddMember("mallory", key); err == nil {
+		t.Fatal("a sender key is added under another name")
+	}
+
+	short, _ := memguard.NewImmutableFromBytes(append([]byte(nil), key.Buffer()[:len(key.Buffer())-1]...))
+	defer short.Destroy()
+	if err := gs["bob"].AddMember("alice", short); err == nil {
+		t.Fatal("a truncated sender key is added")
+	}
+}
+
+func TestGroupSkipped(t *testing.T) {
+	gs := newGroup(t, "alice", "bob")
+	defer destroyGroup(gs)
+
+	var payloads [][]byte
+	for i := 0; i < maxSkip+2; i++ {
+		payloads = append(payloads, groupSeal(t, gs["alice"], "hello"))
+	}
+
+	// Too many keys to skip at once.
+	if _, _, err := gs["bob"].Open(payloads[maxSkip+1]); err == nil {
+		t.Fatal("skipped more than maxSkip keys")
+	}
+
+	groupOpen(t, gs["bob"], payloads[maxSkip], "alice", "hello")
+	groupOpen(t, gs["bob"], payloads[maxSkip+1], "alice", "hello")
+	groupOpen(t, gs["bob"], payloads[0], "alice", "hello")
+}
@@ -0,0 +1,156 @@
+package core
+
+import (
+	"crypto/mlkem"
+	"crypto/subtle"
+	"errors"
+
+	"ekyu.moe/leb128"
+	"golang.org/x/crypto/sha3"
+)
+
+// CommitmentSize is the size of a commitment to a hello, see Commit.
+const CommitmentSize = 32
+
+// Extension types of Hello.
+const (
+	extIdentity = 1
+	extPAKE     = 2
+	extSuites   = 3
+	extKEM      = 4
+)
+
+var commitmentInfo = []byte("soda commitment")
+
+// Hello is the public-key packet each side sends to the other before the
+// session begins.
+//
+// Wire format:
+//     pub[32] + extensions...
+// where each extension is
+//     type[1] + uleb128(len) + value[len]
+// so that a bare 32 bytes public key is still a valid Hello. Unknown
+// extensions are skipped.
+type Hello struct {
+	Pub *[32]byte
+
+	// Identity is the partner's long-term identity public key, and Binding
+	// is its signature over Pub. Both are nil for anonymous partners.
+	Identity []byte
+	Binding  []byte
+
+	// PAKE is the partner's element of a passphrase-authenticated key
+	// exchange, see StartPAKE.
+	PAKE *[32]byte
+
+	// Suites are the cipher suites the partner offers. A partner who offers
+	// nothing only knows secretbox.
+	Suites []Suite
+
+	// KEM is the partner's ML-KEM-768 encapsulation key of a hybrid key
+	// exchange, see StartKEM.
+	KEM []byte
+}
+
+// Marshal encodes the hello.
+func (h *Hello) Marshal() []byte {
+	ret := append([]byte(nil), h.Pub[:]...)
+
+	if h.Identity != nil {
+		ret = appendExtension(ret, extIdentity, append(append([]byte(nil), h.Identity...), h.Binding...))
+	}
+	if h.PAKE != nil {
+		ret = appendExtension(ret, extPAKE, h.PAKE[:])
+	}
+	if len(h.Suites) > 0 {
+		suites := make([]byte, len(h.Suites))
+		for i, c := range h.Suites {
+			suites[i] = byte(c)
+		}
+		ret = appendExtension(ret, extSuites, suites)
+	}
+	if h.KEM != nil {
+		ret = appendExtension(ret, extKEM, h.KEM)
+	}
+
+	return ret
+}
+
+// ParseHello decodes a hello.
+func ParseHello(p []byte) (*Hello, error) {
+	if len(p) < 32 {
+		return nil, errors.New("hello: wrong public key size")
+	}
+
+	h := &Hello{Pub: new([32]byte)}
+	copy(h.Pub[:], p[:32])
+
+	for rest := p[32:]; len(rest) > 0; {
+		typ := rest[0]
+		l, n := leb128.DecodeUleb128(rest[1:])
+		if n == 0 || uint64(len(rest)-1-int(n)) < l {
+			return nil, errors.New("hello: bad extension")
+		}
+		value := rest[1+int(n) : 1+int(n)+int(l)]
+		rest = rest[1+int(n)+int(l):]
+
+		switch typ {
+		case extIdentity:
+			// ed25519 public key + signature
+			if len(value) != 32+64 {
+				return nil, errors.New("hello: bad identity extension")
+			}
+			h.Identity = value[:32]
+			h.Binding = value[32:]
+
+		case extPAKE:
+			if len(value) != 32 {
+				return nil, errors.New("hello: bad pake extension")
+			}
+			h.PAKE = new([32]byte)
+			copy(h.PAKE[:], value)
+
+		case extSuites:
+			if len(value) == 0 || len(value) > 255 {
+				return nil, errors.New("hello: bad suites extension")
+			}
+			h.Suites = make([]Suite, len(value))
+			for i, c := range value {
+				h.Suites[i] = Suite(c)
+			}
+
+		case extKEM:
+			if len(value) != mlkem.EncapsulationKeySize768 {
+				return nil, errors.New("hello: bad kem extension")
+			}
+			h.KEM = value
+		}
+	}
+
+	return h, nil
+}
+
+func appendExtension(b []byte, typ byte, value []byte) []byte {
+	b = append(b, typ)
+	b = leb128.AppendUleb128(b, uint64(len(value)))
+	return append(b, value...)
+}
+
+// Commit returns the commitment to a marshaled hello:
+//     commitment := SHA3-256("soda commitment" + hello)
+// Each side sends its commitment first, and only sends the hello itself once
+// it has the partner's commitment. Someone in the middle then has to commit to
+// his keys before seeing ours, which is what keeps the short authentication
+// string short, see Session.AuthString.
+func Commit(hello []byte) []byte {
+	h := sha3.New256()
+	h.Write(commitmentInfo)
+	h.Write(hello)
+
+	return h.Sum(nil)
+}
+
+// CheckCommitment reports whether hello is the one commitment is made to.
+func CheckCommitment(commitment, hello []byte) bool {
+	return subtle.ConstantTimeCompare(commitment, Commit(hello)) == 1
+}
@@ -0,0 +1,198 @@
+package core
+
+import (
+	"bytes"
+	"crypto/mlkem"
+	"errors"
+
+	"github.com/awnumar/memguard"
+	"golang.org/x/crypto/sha3"
+)
+
+var (
+	kemSecretInfo = []byte("soda hybrid")
+	kemDigestInfo = []byte("soda hybrid keys")
+)
+
+// kemState is the ML-KEM-768 half of a hybrid key exchange. Each side
+// encapsulates a secret to the other's encapsulation key, so both sides
+// contribute one.
+type kemState struct {
+	seed *memguard.LockedBuffer
+	ek   []byte
+
+	peerEK []byte
+	ctOut  []byte
+	ssOut  *memguard.LockedBuffer
+	ctIn   []byte
+	ssIn   *memguard.LockedBuffer
+}
+
+// StartKEM prepares a hybrid key exchange, which adds ML-KEM-768 on top of
+// X25519 so that a recording of the conversation stays safe even against a
+// quantum computer. The encapsulation key returned must be sent to the partner
+// along with PublicKey.
+//
+// The partner's encapsulation key then goes to Encapsulate, and the ciphertext
+// it returns is sent back. The partner's ciphertext goes to Decapsulate, and
+// only then can the session Compute.
+func (s *Session) StartKEM() ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.seq != 0 || s.kem != nil {
+		return nil, errors.New("kem: already started")
+	}
+	if s.noise != nil {
+		return nil, errors.New("kem: can't be used along with a Noise handshake")
+	}
+
+	seed, err := memguard.NewImmutableRandom(mlkem.SeedSize)
+	if err != nil {
+		return nil, err
+	}
+
+	dk, err := mlkem.NewDecapsulationKey768(seed.Buffer())
+	if err != nil {
+		seed.Destroy()
+		return nil, err
+	}
+
+	s.kem = &kemState{
+		seed: seed,
+		ek:   dk.EncapsulationKey().Bytes(),
+	}
+
+	return s.kem.ek, nil
+}
+
+// Encapsulate generates a secret for the partner and returns the ciphertext
+// to be sent to them.
+func (s *Session) Encapsulate(peer *Hello) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.kem == nil {
+		return nil, errors.New("kem: not started")
+	}
+	if peer.KEM == nil {
+		return nil, errors.New("kem: partner is not using a hybrid key exchange")
+	}
+	if s.kem.ssOut != nil {
+		return nil, errors.New("kem: already encapsulated")
+	}
+	if bytes.Equal(peer.KEM, s.kem.ek) {
+		return nil, errors.New("kem: two encapsulation keys are the same")
+	}
+
+	ek, err := mlkem.NewEncapsulationKey768(peer.KEM)
+	if err != nil {
+		return nil, errors.New("kem: " + err.Error())
+	}
+
+	secret, ct := ek.Encapsulate()
+
+	// Wipes secret
+	ss, err := memguard.NewImmutableFromBytes(secret)
+	if err != nil {
+		return nil, err
+	}
+
+	s.kem.peerEK = append([]byte(nil), peer.KEM...)
+	s.kem.ctOut = ct
+	s.kem.ssOut = ss
+
+	return ct, nil
+}
+
+// Decapsulate recovers the secret the partner has generated for us.
+func (s *Session) Decapsulate(ct []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.kem == nil {
+		return errors.New("kem: not started")
+	}
+	if s.kem.ssIn != nil {
+		return errors.New("kem: already decapsulated")
+	}
+	if len(ct) != mlkem.CiphertextSize768 {
+		return errors.New("kem: wrong ciphertext size")
+	}
+
+	dk, err := mlkem.NewDecapsulationKey768(s.kem.seed.Buffer())
+	if err != nil {
+		return err
+	}
+
+	// ML-KEM never fails on a bad ciphertext, it returns a secret nobody
+	// else knows, so a tampered one shows up as mismatched keys later.
+	secret, err := dk.Decapsulate(ct)
+	if err != nil {
+		return errors.New("kem: " + err.Error())
+	}
+
+	ss, err := memguard.NewImmutableFromBytes(secret)
+	if err != nil {
+		return err
+	}
+
+	s.kem.ctIn = append([]byte(nil), ct...)
+	s.kem.ssIn = ss
+
+	return nil
+}
+
+// combine mixes both ML-KEM secrets into the X25519 root key, along with
+// everything exchanged for them:
+//     root' := SHA3-256("soda hybrid" + root + secretToAlice + secretToBob +
+//                       AliceEK + BobEK + ciphertextToAlice + ciphertextToBob)
+// It also returns a digest of both encapsulation keys, for the short
+// authentication string.
+func (k *kemState) combine(root *memguard.LockedBuffer, isAlice bool) (*memguard.LockedBuffer, *[32]byte, error) {
+	if k.ssOut == nil || k.ssIn == nil {
+		return nil, nil, errors.New("kem: ciphertexts are not exchanged yet")
+	}
+
+	// For Alice, what comes in is to Alice.
+	ssAlice, ssBob := k.ssIn, k.ssOut
+	ekAlice, ekBob := k.ek, k.peerEK
+	ctAlice, ctBob := k.ctIn, k.ctOut
+	if !isAlice {
+		ssAlice, ssBob = ssBob, ssAlice
+		ekAlice, ekBob = ekBob, ekAlice
+		ctAlice, ctBob = ctBob, ctAlice
+	}
+
+	h := sha3.New256()
+	h.Write(kemSecretInfo)
+	h.Write(root.Buffer())
+	h.Write(ssAlice.Buffer())
+	h.Write(ssBob.Buffer())
+	h.Write(ekAlice)
+	h.Write(ekBob)
+	h.Write(ctAlice)
+	h.Write(ctBob)
+
+	combined, err := memguard.NewImmutableFromBytes(h.Sum(nil))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	digest := new([32]byte)
+	h = sha3.New256()
+	h.Write(kemDigestInfo)
+	h.Write(ekAlice)
+	h.Write(ekBob)
+	h.Sum(digest[:0])
+
+	return combined, digest, nil
+}
+
+func (k *kemState) destroy() {
+	for _, b := range []*memguard.LockedBuffer{k.seed, k.ssOut, k.ssIn} {
+		if b != nil {
+			b.Destroy()
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package core
+
+import (
+	"bytes"
+	"testing"
+)
+
+// kemPair runs the ML-KEM half of a hybrid key exchange between two sessions,
+// calling tamper on the ciphertext Alice gets, then has them compute.
+func kemPair(t *testing.T, tamper func([]byte)) (*Session, *Session) {
+	t.Helper()
+
+	alice, _ := NewSession()
+	bob, _ := NewSession()
+	ekA, err := alice.StartKEM()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ekB, err := bob.StartKEM()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	helloA, _ := ParseHello((&Hello{Pub: alice.PublicKey(), Suites: alice.Suites(), KEM: ekA}).Marshal())
+	helloB, _ := ParseHello((&Hello{Pub: bob.PublicKey(), Suites: bob.Suites(), KEM: ekB}).Marshal())
+
+	if err := alice.Compute(helloB); err == nil {
+		t.Fatal("computed before the ciphertexts are exchanged")
+	}
+
+	ctA, err := alice.Encapsulate(helloB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctB, err := bob.Encapsulate(helloA)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tamper != nil {
+		tamper(ctB)
+	}
+	if err := alice.Decapsulate(ctB); err != nil {
+		t.Fatal(err)
+	}
+	if err := bob.Decapsulate(ctA); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := alice.Compute(helloB); err != nil {
+		t.Fatal(err)
+	}
+	if err := bob.Compute(helloA); err != nil {
+		t.Fatal(err)
+	}
+
+	return alice, bob
+}
+
+func TestKEM(t *testing.T) {
+	alice, bob := kemPair(t, nil)
+	defer alice.Destroy()
+	defer bob.Destroy()
+
+	if !bytes.Equal(alice.AuthString(), bob.AuthString()) {
+		t.Fatal("auth strings differ")
+	}
+	tag, _ := alice.Confirmation()
+	if err := bob.VerifyConfirmation(tag); err != nil {
+		t.Fatal(err)
+	}
+	mustOpen(t, bob, mustSeal(t, alice, "hello"), "hello")
+	mustOpen(t, alice, mustSeal(t, bob, "hi"), "hi")
+}
+
+// A tampered ciphertext decapsulates to another secret, so the keys do not
+// match.
+func TestKEMTampered(t *testing.T) {
+	alice, bob := kemPair(t, func(ct []byte) { ct[5] ^= 0x01 })
+	defer alice.Destroy()
+	defer bob.Destroy()
+
+	tag, _ := alice.Confirmation()
+	if err := bob.VerifyConfirmation(tag); err == nil {
+		t.Fatal("keys match with a tampered ciphertext")
+	}
+	if _, err := bob.Open(mustSeal(t, alice, "hello")); err == nil {
+		t.Fatal("a message is opened with mismatched keys")
+	}
+}
+
+func TestKEMMixed(t *testing.T) {
+	alice, _ := NewSession()
+	bob, _ := NewSession()
+	defer alice.Destroy()
+	defer bob.Destroy()
+
+	ek, _ := alice.StartKEM()
+	if err := alice.Compute(&Hello{Pub: bob.PublicKey()}); err == nil {
+		t.Fatal("only one side is using a hybrid key exchange, yet it is computed")
+	}
+	if _, err := alice.Encapsulate(&Hello{Pub: bob.PublicKey(), KEM: ek}); err == nil {
+		t.Fatal("our own encapsulation key is accepted")
+	}
+	if err := alice.Decapsulate(make([]byte, 10)); err == nil {
+		t.Fatal("a ciphertext of the wrong size is accepted")
+	}
+}
@@ -0,0 +1,397 @@
+package core
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"io"
+
+	"github.com/awnumar/memguard"
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/hkdf"
+)
+
+const (
+	// NoiseProtocol is the Noise protocol name of the Noise handshake mode.
+	NoiseProtocol = "Noise_NN_25519_ChaChaPoly_SHA256"
+
+	// noiseMaxMessage is the maximum size of a Noise message.
+	noiseMaxMessage = 65535
+
+	// noiseWindow is how far from the next expected nonce a transport message
+	// is looked for, either way, see openNoise.
+	noiseWindow = 64
+
+	// noiseAuthStringSize is the size of the short authentication string of
+	// a Noise session, see AuthString.
+	noiseAuthStringSize = 10
+)
+
+// noiseState is the state of a Noise handshake, then the cipher states of
+// both directions once it is done.
+type noiseState struct {
+	initiator bool
+
+	// Whether the first handshake message has been written or read.
+	started bool
+
+	// The chaining key and handshake hash of the symmetric state. h is kept
+	// after the handshake for channel binding.
+	ck [32]byte
+	h  [32]byte
+
+	send *memguard.LockedBuffer
+	recv *memguard.LockedBuffer
+}
+
+// StartNoise switches the session to the Noise handshake mode, in which the
+// handshake messages take the place of Compute and the hellos, and the partner
+// can be any Noise implementation. The key pair of the session is used as the
+// ephemeral key pair.
+//
+// The handshake is Noise_NN_25519_ChaChaPoly_SHA256, with an empty prologue:
+//     -> e
+//     <- e, ee
+// The initiator writes the first message by WriteNoiseMessage, the responder
+// reads it by ReadNoiseMessage and writes the second one, which the initiator
+// reads. Both messages carry an empty payload. Payloads sent by the partner are
+// authenticated as usual, then ignored.
+//
+// Afterwards, Seal and Open send and receive plain Noise transport messages,
+// ChaChaPoly with an empty associated data and the nonce counted implicitly
+// from zero in each direction. The Double Ratchet, cipher suites, key
+// confirmation, rekeying, broadcasts and Export are not used in this mode.
+func (s *Session) StartNoise(initiator bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.seq != 0 || s.noise != nil {
+		return errors.New("noise: already started")
+	}
+	if s.pakeScalar != nil || s.kem != nil {
+		return errors.New("noise: can't be used along with a passphrase or a hybrid key exchange")
+	}
+
+	// It can't be rekeyed, see SetRekeyPolicy.
+	s.rekeyMessages = 0
+	s.rekeyInterval = 0
+
+	// InitializeSymmetric, the protocol name is exactly 32 bytes long.
+	n := &noiseState{initiator: initiator}
+	copy(n.h[:], NoiseProtocol)
+	n.ck = n.h
+	mixHash(&n.h, nil) // prologue
+
+	s.noise = n
+	s.isAlice = initiator
+
+	return nil
+}
+
+// WriteNoiseMessage returns our next handshake message to be sent to the
+// partner, see StartNoise. The handshake is done once the responder has
+// written the second message.
+func (s *Session) WriteNoiseMessage() ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.noise == nil {
+		return nil, errors.New("noise: not started")
+	}
+	if s.seq != 0 {
+		return nil, errors.New("noise: handshake already done")
+	}
+
+	n := s.noise
+	if n.initiator {
+		if n.started {
+			return nil, errors.New("noise: first message already written")
+		}
+
+		// -> e
+		mixHash(&n.h, s.pub[:])
+		mixHash(&n.h, nil) // payload
+		n.started = true
+
+		return append([]byte(nil), s.pub[:]...), nil
+	}
+
+	if !n.started {
+		return nil, errors.New("noise: the initiator's message must be read first")
+	}
+
+	// <- e, ee
+	h, ck := n.h, n.ck
+	mixHash(&h, s.pub[:])
+	tag, err := mixDH(&ck, s.pri, s.peerPub, func(k *memguard.LockedBuffer) ([]byte, error) {
+		return noiseSeal(k, 0, h[:], nil)
+	})
+	if err != nil {
+		return nil, errors.New("noise: " + err.Error())
+	}
+	mixHash(&h, tag)
+
+	n.h, n.ck = h, ck
+	if err := s.splitNoise(); err != nil {
+		return nil, errors.New("noise: " + err.Error())
+	}
+
+	return append(append([]byte(nil), s.pub[:]...), tag...), nil
+}
+
+// ReadNoiseMessage reads the partner's handshake message, see StartNoise. The
+// session is left untouched if the message is bad, so it can be read again.
+func (s *Session) ReadNoiseMessage(msg []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.noise == nil {
+		return errors.New("noise: not started")
+	}
+	if s.seq != 0 {
+		return errors.New("noise: handshake already done")
+	}
+	if len(msg) < 32 || len(msg) > noiseMaxMessage {
+		return errors.New("noise: bad message size")
+	}
+
+	pub := new([32]byte)
+	copy(pub[:], msg)
+	if err := s.checkPeer(pub); err != nil {
+		return errors.New("noise: " + err.Error())
+	}
+
+	n := s.noise
+	h, ck := n.h, n.ck
+	if !n.initiator {
+		if n.started {
+			return errors.New("noise: first message already read")
+		}
+
+		// -> e
+		mixHash(&h, pub[:])
+		mixHash(&h, msg[32:]) // payload
+
+		n.h = h
+		n.started = true
+		s.peerPub = pub
+
+		return nil
+	}
+
+	if !n.started {
+		return errors.New("noise: the first message must be written first")
+	}
+	if len(msg) < 32+chacha20poly1305.Overhead {
+		return errors.New("noise: bad message size")
+	}
+
+	// <- e, ee
+	mixHash(&h, pub[:])
+	_, err := mixDH(&ck, s.pri, pub, func(k *memguard.LockedBuffer) ([]byte, error) {
+		return noiseOpen(k, 0, h[:], msg[32:])
+	})
+	if err != nil {
+		return errors.New("noise: " + err.Error())
+	}
+	mixHash(&h, msg[32:])
+
+	n.h, n.ck = h, ck
+	s.peerPub = pub
+	if err := s.splitNoise(); err != nil {
+		return errors.New("noise: " + err.Error())
+	}
+
+	return nil
+}
+
+// mixDH mixes the shared secret of pri and pub into ck, then runs f with the
+// new cipher key, which is destroyed afterwards. ck is only updated if f
+// succeeds.
+func mixDH(ck *[32]byte, pri *memguard.LockedBuffer, pub *[32]byte, f func(*memguard.LockedBuffer) ([]byte, error)) ([]byte, error) {
+	shared, err := dh(pri, pub)
+	if err != nil {
+		return nil, err
+	}
+	defer shared.Destroy()
+
+	next := *ck
+	k, err := mixKey(&next, shared.Buffer())
+	if err != nil {
+		return nil, err
+	}
+	defer k.Destroy()
+
+	ret, err := f(k)
+	if err != nil {
+		return nil, errors.New("authentication failed")
+	}
+	*ck = next
+
+	return ret, nil
+}
+
+// splitNoise derives the cipher states of both directions and ends the
+// handshake.
+func (s *Session) splitNoise() error {
+	c1, c2, err := noiseHKDF(s.noise.ck[:], nil)
+	if err != nil {
+		return err
+	}
+	if !s.noise.initiator {
+		c1, c2 = c2, c1
+	}
+
+	s.noise.send = c1
+	s.noise.recv = c2
+	s.noise.ck = [32]byte{}
+
+	s.pri.Destroy()
+	s.pri = nil
+	s.seq = 1
+
+	return nil
+}
+
+// noiseAuthString is the short authentication string of a Noise session, the
+// beginning of the handshake hash, which any Noise implementation can show.
+//     sas := h[:10]
+// Without commitments, someone in the middle sees the initiator's key before
+// he picks his own. Once the responder has answered him, though, the hash on
+// that side is fixed, and he has to search for a key that gives the same 80
+// bits on the initiator's side, which takes about 2^80 tries.
+func (s *Session) noiseAuthString() []byte {
+	return append([]byte(nil), s.noise.h[:noiseAuthStringSize]...)
+}
+
+// sealNoise seals body as a transport message.
+func (s *Session) sealNoise(typ byte, body []byte) ([]byte, error) {
+	if typ != typeData {
+		return nil, errors.New("seal: not supported by a Noise session")
+	}
+	if len(body)+chacha20poly1305.Overhead > noiseMaxMessage {
+		return nil, errors.New("seal: message too long for a Noise session")
+	}
+
+	sealed, err := noiseSeal(s.noise.send, s.seq-1, nil, body)
+	if err != nil {
+		return nil, errors.New("seal: " + err.Error())
+	}
+	s.seq++
+
+	return sealed, nil
+}
+
+// openNoise opens a transport message. Noise transport messages don't carry
+// their nonce, so a message that arrives out of order is found by trying the
+// nonces around the next expected one, that one first. Our partner needs
+// nothing of it and may be any Noise implementation, which only ever sends in
+// order. Replays are rejected as with our own messages, by seq = nonce + 1.
+func (s *Session) openNoise(payload []byte) ([]byte, error) {
+	if len(payload) < chacha20poly1305.Overhead || len(payload) > noiseMaxMessage {
+		return nil, errors.New("open: bad message size")
+	}
+
+	aead, err := chacha20poly1305.New(s.noise.recv.Buffer())
+	if err != nil {
+		return nil, errors.New("open: " + err.Error())
+	}
+
+	next := s.recvSeq + 1
+	try := []uint64{next}
+	for seq := next - 1; seq > 0 && seq+noiseWindow > next; seq-- {
+		if _, ok := s.missing[seq]; ok {
+			try = append(try, seq)
+		}
+	}
+	for seq := next + 1; seq < next+noiseWindow; seq++ {
+		try = append(try, seq)
+	}
+
+	for _, seq := range try {
+		if s.checkSeq(seq) != nil {
+			continue
+		}
+		if raw, err := aead.Open(nil, noiseNonce(seq-1), payload, nil); err == nil {
+			s.markSeq(seq)
+			return raw, nil
+		}
+	}
+
+	return nil, errors.New("open: authentication failed")
+}
+
+func (n *noiseState) destroy() {
+	for _, b := range []*memguard.LockedBuffer{n.send, n.recv} {
+		if b != nil {
+			b.Destroy()
+		}
+	}
+}
+
+func mixHash(h *[32]byte, data []byte) {
+	d := sha256.New()
+	d.Write(h[:])
+	d.Write(data)
+	d.Sum(h[:0])
+}
+
+// mixKey updates ck and returns the new cipher key.
+func mixKey(ck *[32]byte, ikm []byte) (*memguard.LockedBuffer, error) {
+	next, k, err := noiseHKDF(ck[:], ikm)
+	if err != nil {
+		return nil, err
+	}
+	copy(ck[:], next.Buffer())
+	next.Destroy()
+
+	return k, nil
+}
+
+// noiseHKDF is HKDF of Noise with two outputs, which is the same as HKDF of
+// RFC 5869 with ck as the salt and an empty info.
+func noiseHKDF(ck, ikm []byte) (*memguard.LockedBuffer, *memguard.LockedBuffer, error) {
+	buf := make([]byte, 64)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, ikm, ck, nil), buf); err != nil {
+		return nil, nil, err
+	}
+
+	// Both wipe the source
+	out1, err := memguard.NewImmutableFromBytes(buf[:32])
+	if err != nil {
+		return nil, nil, err
+	}
+	out2, err := memguard.NewImmutableFromBytes(buf[32:])
+	if err != nil {
+		out1.Destroy()
+		return nil, nil, err
+	}
+
+	return out1, out2, nil
+}
+
+// noiseNonce is 32 bits of zeros followed by the little endian counter.
+func noiseNonce(n uint64) []byte {
+	nonce := make([]byte, chacha20poly1305.NonceSize)
+	binary.LittleEndian.PutUint64(nonce[4:], n)
+
+	return nonce
+}
+
+func noiseSeal(k *memguard.LockedBuffer, n uint64, ad, plain []byte) ([]byte, error) {
+	aead, err := chacha20poly1305.New(k.Buffer())
+	if err != nil {
+		return nil, err
+	}
+
+	return aead.Seal(nil, noiseNonce(n), plain, ad), nil
+}
+
+func noiseOpen(k *memguard.LockedBuffer, n uint64, ad, sealed []byte) ([]byte, error) {
+	aead, err := chacha20poly1305.New(k.Buffer())
+	if err != nil {
+		return nil, err
+	}
+
+	return aead.Open(nil, noiseNonce(n), sealed, ad)
+}
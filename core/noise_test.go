@@ -0,0 +1,229 @@
+package core
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/awnumar/memguard"
+)
+
+// newNoisePair returns two sessions that have run the Noise handshake, alice
+// being the initiator.
+func newNoisePair(t *testing.T) (*Session, *Session) {
+	t.Helper()
+
+	alice, _ := NewSession()
+	bob, _ := NewSession()
+	if err := alice.StartNoise(true); err != nil {
+		t.Fatal(err)
+	}
+	if err := bob.StartNoise(false); err != nil {
+		t.Fatal(err)
+	}
+
+	first, err := alice.WriteNoiseMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := bob.ReadNoiseMessage(first); err != nil {
+		t.Fatal(err)
+	}
+	second, err := bob.WriteNoiseMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := alice.ReadNoiseMessage(second); err != nil {
+		t.Fatal(err)
+	}
+
+	return alice, bob
+}
+
+func TestNoise(t *testing.T) {
+	alice, bob := newNoisePair(t)
+	defer alice.Destroy()
+	defer bob.Destroy()
+
+	if sas := alice.AuthString(); len(sas) != noiseAuthStringSize || !bytes.Equal(sas, bob.AuthString()) {
+		t.Fatal("auth strings do not match")
+	}
+
+	// In order, then out of order
+	mustOpen(t, bob, mustSeal(t, alice, "hello"), "hello")
+	mustOpen(t, alice, mustSeal(t, bob, "hi"), "hi")
+
+	first := mustSeal(t, alice, "first")
+	second := mustSeal(t, alice, "second")
+	mustOpen(t, bob, second, "second")
+	mustOpen(t, bob, first, "first")
+
+	if _, err := bob.Open(first); err == nil {
+		t.Fatal("a replay is opened")
+	}
+	if missing := bob.Missing(); len(missing) != 0 {
+		t.Fatalf("got missing %v", missing)
+	}
+}
+
+// A transport message is ChaChaPoly alone, under the nonce counted from zero.
+func TestNoiseTransport(t *testing.T) {
+	alice, bob := newNoisePair(t)
+	defer alice.Destroy()
+	defer bob.Destroy()
+
+	for i := uint64(0); i < 3; i++ {
+		payload := mustSeal(t, alice, "hello")
+		raw, err := noiseOpen(bob.noise.recv, i, nil, payload)
+		if err != nil || string(raw) != "hello" {
+			t.Fatalf("message %d is not a plain transport message", i)
+		}
+	}
+
+	sealed, err := noiseSeal(alice.noise.recv, 0, nil, []byte("from elsewhere"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	mustOpen(t, alice, sealed, "from elsewhere")
+}
+
+func TestNoiseHandshakeBad(t *testing.T) {
+	alice, _ := NewSession()
+	bob, _ := NewSession()
+	defer alice.Destroy()
+	defer bob.Destroy()
+	alice.StartNoise(true)
+	bob.StartNoise(false)
+
+	if _, err := bob.WriteNoiseMessage(); err == nil {
+		t.Fatal("the responder writes before reading")
+	}
+	if err := bob.ReadNoiseMessage(make([]byte, 31)); err == nil {
+		t.Fatal("a short first message is read")
+	}
+
+	first, _ := alice.WriteNoiseMessage()
+	if _, err := alice.WriteNoiseMessage(); err == nil {
+		t.Fatal("the first message is written twice")
+	}
+	if err := bob.ReadNoiseMessage(first); err != nil {
+		t.Fatal(err)
+	}
+	second, _ := bob.WriteNoiseMessage()
+
+	// A tampered second message leaves the initiator as it was.
+	for i := range second {
+		tampered := append([]byte(nil), second...)
+		tampered[i] ^= 0x01
+		if err := alice.ReadNoiseMessage(tampered); err == nil {
+			t.Fatalf("tampered byte %d is accepted", i)
+		}
+	}
+	if err := alice.ReadNoiseMessage(second); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := alice.ReadNoiseMessage(second); err == nil {
+		t.Fatal("a message is read after the handshake")
+	}
+	if _, err := alice.Confirmation(); err == nil {
+		t.Fatal("a Noise session makes a key confirmation")
+	}
+}
+
+func TestNoiseTampered(t *testing.T) {
+	alice, bob := newNoisePair(t)
+	defer alice.Destroy()
+	defer bob.Destroy()
+
+	payload := mustSeal(t, alice, "hello")
+	for i := range payload {
+		tampered := append([]byte(nil), payload...)
+		tampered[i] ^= 0x01
+		if plain, err := bob.Open(tampered); err == nil {
+			plain.Destroy()
+			t.Fatalf("tampered byte %d is accepted", i)
+		}
+	}
+
+	mustOpen(t, bob, payload, "hello")
+}
+
+func TestNoiseShort(t *testing.T) {
+	alice, bob := newNoisePair(t)
+	defer alice.Destroy()
+	defer bob.Destroy()
+
+	payload := mustSeal(t, alice, "a")
+	if len(payload) != 1+16 {
+		t.Fatalf("got a payload of %d bytes", len(payload))
+	}
+	for i := 0; i < len(payload); i++ {
+		if _, err := bob.Open(payload[:i]); err == nil {
+			t.Fatalf("a truncated payload of %d bytes is accepted", i)
+		}
+	}
+	mustOpen(t, bob, payload, "a")
+}
+
+func TestNoiseWindow(t *testing.T) {
+	alice, bob := newNoisePair(t)
+	defer alice.Destroy()
+	defer bob.Destroy()
+
+	for i := 0; i < noiseWindow; i++ {
+		mustSeal(t, alice, "lost")
+	}
+	if _, err := bob.Open(mustSeal(t, alice, "too far")); err == nil {
+		t.Fatal("a message beyond the window is opened")
+	}
+}
+
+func TestNoiseMixed(t *testing.T) {
+	alice, _ := NewSession()
+	bob, _ := NewSession()
+	defer alice.Destroy()
+	defer bob.Destroy()
+
+	if err := alice.StartNoise(true); err != nil {
+		t.Fatal(err)
+	}
+	if err := computePair(alice, bob); err == nil {
+		t.Fatal("a Noise session is computed from a hello")
+	}
+	if _, err := alice.StartKEM(); err == nil {
+		t.Fatal("a Noise session starts a hybrid key exchange")
+	}
+}
+
+func TestNoiseUnsupported(t *testing.T) {
+	alice, bob := newNoisePair(t)
+	defer alice.Destroy()
+	defer bob.Destroy()
+
+	if _, err := alice.Rekey(); err == nil {
+		t.Fatal("a Noise session is rekeyed")
+	}
+	if _, err := alice.Export(); err == nil {
+		t.Fatal("a Noise session is exported")
+	}
+	plain, _ := memguard.NewImmutableFromBytes([]byte("everyone"))
+	if _, err := SealBroadcast([]*Session{alice}, plain); err == nil {
+		t.Fatal("a Noise session broadcasts")
+	}
+}
+
+func TestNoiseRekeyPolicy(t *testing.T) {
+	alice, bob := newNoisePair(t)
+	defer alice.Destroy()
+	defer bob.Destroy()
+
+	if messages, interval := alice.RekeyPolicy(); messages != 0 || interval != 0 {
+		t.Fatalf("got rekey policy %d, %v", messages, interval)
+	}
+	if err := alice.SetRekeyPolicy(10, 0); err == nil {
+		t.Fatal("a rekey policy is set on a Noise session")
+	}
+	if err := alice.SetRekeyPolicy(0, 0); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,176 @@
+package core
+
+import (
+	"bytes"
+	"crypto/sha512"
+	"errors"
+	"math/big"
+
+	"github.com/awnumar/memguard"
+	"golang.org/x/crypto/curve25519"
+)
+
+var (
+	pakeGeneratorInfo = []byte("soda cpace generator")
+	pakeSecretInfo    = []byte("soda cpace isk")
+
+	// Curve25519 constants for Elligator 2.
+	fieldPrime  = new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 255), big.NewInt(19))
+	curveA      = big.NewInt(486662)
+	legendreExp = new(big.Int).Rsh(new(big.Int).Sub(fieldPrime, big.NewInt(1)), 1)
+)
+
+// StartPAKE prepares a passphrase-authenticated key exchange, which is CPace
+// over Curve25519. Instead of the base point, the generator is derived from
+// the passphrase, so the element returned is only useful to someone who knows
+// the same passphrase. It must be sent to the partner along with PublicKey.
+//
+// The passphrase can be destroyed once StartPAKE returns.
+func (s *Session) StartPAKE(passphrase []byte) (*[32]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.seq != 0 || s.pakeScalar != nil {
+		return nil, errors.New("pake: already started")
+	}
+	if s.noise != nil {
+		return nil, errors.New("pake: can't be used along with a Noise handshake")
+	}
+
+	generator := pakeGenerator(passphrase)
+
+	scalar, err := memguard.NewImmutableRandom(32)
+	if err != nil {
+		return nil, err
+	}
+
+	element := new([32]byte)
+	curve25519.ScalarMult(element, array32(scalar), generator)
+
+	s.pakeScalar = scalar
+	s.pakeElement = element
+
+	return element, nil
+}
+
+// ComputePAKE is Compute for a session started by StartPAKE, with the
+// partner's public key and PAKE element from the partner's hello. The root key
+// only matches when both sides have used the same passphrase:
+//     K    := X25519(scalar, partnerElement)
+//     root := SHA-512("soda cpace isk" + AliceElement + BobElement +
+//                     AlicePub + BobPub + K)[:32]
+// Everything exchanged is bound to the root key, so a man in the middle who
+// does not know the passphrase gets nothing out of tampering with it.
+func (s *Session) ComputePAKE(peer *Hello) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.pakeScalar == nil {
+		return errors.New("pake: not started")
+	}
+	if peer.PAKE == nil {
+		return errors.New("pake: partner is not using a passphrase")
+	}
+
+	pub, element := peer.Pub, peer.PAKE
+	if err := s.checkPeer(pub); err != nil {
+		return errors.New("pake: " + err.Error())
+	}
+	if bytes.Equal(element[:], s.pakeElement[:]) {
+		return errors.New("pake: two elements are the same")
+	}
+
+	// A low order element gives an all-zero K, which dh rejects.
+	k, err := dh(s.pakeScalar, element)
+	if err != nil {
+		return errors.New("pake: " + err.Error())
+	}
+	defer k.Destroy()
+
+	h := sha512.New()
+	h.Write(pakeSecretInfo)
+	if bytes.Compare(s.pub[:], pub[:]) > 0 {
+		// We are Alice
+		h.Write(s.pakeElement[:])
+		h.Write(element[:])
+		h.Write(s.pub[:])
+		h.Write(pub[:])
+	} else {
+		h.Write(element[:])
+		h.Write(s.pakeElement[:])
+		h.Write(pub[:])
+		h.Write(s.pub[:])
+	}
+	h.Write(k.Buffer())
+
+	root, err := memguard.NewImmutableFromBytes(h.Sum(nil)[:32])
+	if err != nil {
+		return err
+	}
+
+	if err := s.begin(root, peer); err != nil {
+		return errors.New("pake: " + err.Error())
+	}
+
+	s.pakeScalar.Destroy()
+	s.pakeScalar = nil
+
+	return nil
+}
+
+// pakeGenerator maps the passphrase to a point on Curve25519 with Elligator 2,
+// returning its u-coordinate.
+//
+// The map is computed with math/big and is not constant time, but it only
+// depends on a hash of the passphrase, which never leaves this machine.
+func pakeGenerator(passphrase []byte) *[32]byte {
+	h := sha512.New()
+	h.Write(pakeGeneratorInfo)
+	h.Write(passphrase)
+	digest := h.Sum(nil)
+
+	// little endian, top bit cleared
+	digest[31] &= 0x7f
+	r := new(big.Int).SetBytes(reverse(digest[:32]))
+	r.Mod(r, fieldPrime)
+
+	// x1 := -A / (1 + 2r^2)
+	d := new(big.Int).Mul(r, r)
+	d.Lsh(d, 1)
+	d.Add(d, big.NewInt(1))
+	d.Mod(d, fieldPrime)
+	d.ModInverse(d, fieldPrime)
+	x := new(big.Int).Neg(curveA)
+	x.Mul(x, d)
+	x.Mod(x, fieldPrime)
+
+	// gx1 := x1^3 + A*x1^2 + x1
+	gx := new(big.Int).Add(x, curveA)
+	gx.Mul(gx, x)
+	gx.Add(gx, big.NewInt(1))
+	gx.Mul(gx, x)
+	gx.Mod(gx, fieldPrime)
+
+	// If gx1 is not a square, x := -x1 - A
+	if new(big.Int).Exp(gx, legendreExp, fieldPrime).Cmp(big.NewInt(1)) > 0 {
+		x.Neg(x)
+		x.Sub(x, curveA)
+		x.Mod(x, fieldPrime)
+	}
+
+	u := new([32]byte)
+	b := x.Bytes()
+	copy(u[:], reverse(b))
+
+	return u
+}
+
+// reverse returns a reversed copy of b.
+func reverse(b []byte) []byte {
+	ret := make([]byte, len(b))
+	for i, v := range b {
+		ret[len(b)-1-i] = v
+	}
+
+	return ret
+}
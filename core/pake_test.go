@@ -0,0 +1,104 @@
+package core
+
+import (
+	"math/big"
+	"testing"
+)
+
+// newPAKEPair returns two sessions that have run a PAKE, with passphrases a
+// and b.
+func newPAKEPair(t *testing.T, a, b string) (*Session, *Session) {
+	t.Helper()
+
+	alice, _ := NewSession()
+	bob, _ := NewSession()
+	elementA, err := alice.StartPAKE([]byte(a))
+	if err != nil {
+		t.Fatal(err)
+	}
+	elementB, err := bob.StartPAKE([]byte(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	helloA, _ := ParseHello((&Hello{Pub: alice.PublicKey(), Suites: alice.Suites(), PAKE: elementA}).Marshal())
+	helloB, _ := ParseHello((&Hello{Pub: bob.PublicKey(), Suites: bob.Suites(), PAKE: elementB}).Marshal())
+	if err := alice.ComputePAKE(helloB); err != nil {
+		t.Fatal(err)
+	}
+	if err := bob.ComputePAKE(helloA); err != nil {
+		t.Fatal(err)
+	}
+
+	return alice, bob
+}
+
+func TestPAKE(t *testing.T) {
+	alice, bob := newPAKEPair(t, "correct horse", "correct horse")
+	defer alice.Destroy()
+	defer bob.Destroy()
+
+	tag, _ := alice.Confirmation()
+	if err := bob.VerifyConfirmation(tag); err != nil {
+		t.Fatal(err)
+	}
+	mustOpen(t, bob, mustSeal(t, alice, "hello"), "hello")
+	mustOpen(t, alice, mustSeal(t, bob, "hi"), "hi")
+}
+
+func TestPAKEWrongPassphrase(t *testing.T) {
+	alice, mallory := newPAKEPair(t, "correct horse", "correct house")
+	defer alice.Destroy()
+	defer mallory.Destroy()
+
+	tag, _ := mallory.Confirmation()
+	if err := alice.VerifyConfirmation(tag); err == nil {
+		t.Fatal("keys match with a wrong passphrase")
+	}
+	if _, err := alice.Open(mustSeal(t, mallory, "hello")); err == nil {
+		t.Fatal("a message is opened with a wrong passphrase")
+	}
+}
+
+func TestPAKEBadElement(t *testing.T) {
+	alice, _ := NewSession()
+	defer alice.Destroy()
+	bob, _ := NewSession()
+	defer bob.Destroy()
+
+	element, _ := alice.StartPAKE([]byte("correct horse"))
+
+	// Our own element reflected back
+	if err := alice.ComputePAKE(&Hello{Pub: bob.PublicKey(), PAKE: element}); err == nil {
+		t.Fatal("our own element is accepted")
+	}
+	// A low order element
+	if err := alice.ComputePAKE(&Hello{Pub: bob.PublicKey(), PAKE: new([32]byte)}); err == nil {
+		t.Fatal("a low order element is accepted")
+	}
+	// No element at all
+	if err := alice.ComputePAKE(&Hello{Pub: bob.PublicKey()}); err == nil {
+		t.Fatal("a partner without a passphrase is accepted")
+	}
+}
+
+func TestPAKEGenerator(t *testing.T) {
+	for _, passphrase := range []string{"", "a", "correct horse", "合言葉"} {
+		g := pakeGenerator([]byte(passphrase))
+
+		// u^3 + A*u^2 + u must be a square for u to be on the curve.
+		u := new(big.Int).SetBytes(reverse(g[:]))
+		gu := new(big.Int).Add(u, curveA)
+		gu.Mul(gu, u)
+		gu.Add(gu, big.NewInt(1))
+		gu.Mul(gu, u)
+		gu.Mod(gu, fieldPrime)
+		if new(big.Int).Exp(gu, legendreExp, fieldPrime).Cmp(big.NewInt(1)) > 0 {
+			t.Fatalf("the generator of %q is not on the curve", passphrase)
+		}
+	}
+
+	if *pakeGenerator([]byte("a")) == *pakeGenerator([]byte("b")) {
+		t.Fatal("two passphrases have the same generator")
+	}
+}
@@ -0,0 +1,131 @@
+package core
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/awnumar/memguard"
+)
+
+// These are meant to be run with the race detector, go test -race.
+
+// talk has from seal n messages in one goroutine, which to opens in order in
+// another.
+func talk(t *testing.T, wg *sync.WaitGroup, from, to *Session, n int) {
+	payloads := make(chan []byte, 16)
+
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		defer close(payloads)
+
+		for i := 0; i < n; i++ {
+			plain, _ := memguard.NewImmutableFromBytes([]byte(fmt.Sprint(i)))
+			payload, err := from.Seal(plain)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			payloads <- payload
+		}
+	}()
+	go func() {
+		defer wg.Done()
+
+		i := 0
+		for payload := range payloads {
+			plain, err := to.Open(payload)
+			if err != nil {
+				t.Error(err)
+				for range payloads {
+				}
+				return
+			}
+			if string(plain.Buffer()) != fmt.Sprint(i) {
+				t.Errorf("got %q, want %d", plain.Buffer(), i)
+			}
+			plain.Destroy()
+			i++
+		}
+	}()
+}
+
+func TestConcurrent(t *testing.T) {
+	const n = 200
+
+	for _, noise := range []bool{false, true} {
+		var alice, bob *Session
+		if noise {
+			alice, bob = newNoisePair(t)
+		} else {
+			alice, bob = newPair(t)
+		}
+
+		var wg sync.WaitGroup
+		talk(t, &wg, alice, bob, n)
+		talk(t, &wg, bob, alice, n)
+
+		// Everything else, while they talk.
+		done := make(chan struct{})
+		var others sync.WaitGroup
+		others.Add(1)
+		go func() {
+			defer others.Done()
+
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+
+				for _, s := range []*Session{alice, bob} {
+					s.Missing()
+					s.Suites()
+					s.Seq()
+					s.RekeyDue()
+					if noise {
+						continue
+					}
+
+					state, err := s.Export()
+					if err != nil {
+						t.Error(err)
+						return
+					}
+					resumed, err := Import(state)
+					state.Destroy()
+					if err != nil {
+						t.Error(err)
+						return
+					}
+					resumed.Destroy()
+				}
+			}
+		}()
+
+		wg.Wait()
+		close(done)
+		others.Wait()
+
+		if missing := bob.Missing(); len(missing) != 0 {
+			t.Fatalf("got missing %v", missing)
+		}
+		alice.Destroy()
+		bob.Destroy()
+	}
+}
+
+func TestSuitesCopy(t *testing.T) {
+	alice, bob := newPair(t)
+	defer alice.Destroy()
+	defer bob.Destroy()
+
+	suites := alice.Suites()
+	want := suites[0]
+	suites[0]++
+	if alice.Suites()[0] != want {
+		t.Fatal("Suites returns the slice of the session")
+	}
+}
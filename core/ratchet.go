@@ -0,0 +1,475 @@
+package core
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"errors"
+	"io"
+	"time"
+	"unsafe"
+
+	"ekyu.moe/leb128"
+	"github.com/awnumar/memguard"
+	"golang.org/x/crypto/curve25519"
+	"golang.org/x/crypto/hkdf"
+)
+
+// maxSkip is the maximum number of message keys that can be skipped for a
+// single message, and the number of skipped message keys and seq numbers kept.
+// It stops a malicious partner from making us derive and store an unbounded
+// number of keys. Older ones are forgotten, so messages lost for good do not
+// pile up and stop later ones from being skipped over.
+const maxSkip = 1000
+
+var (
+	ratchetInfo      = []byte("soda ratchet")
+	initialChainInfo = []byte("soda initial chain")
+	messageKeyInput  = []byte{0x01}
+	chainKeyInput    = []byte{0x02}
+)
+
+// header is sent in plain text in front of every sealed message. It is bound to
+// the message key (see sealKey), so tampering with it fails authentication.
+//
+// Wire format:
+//     uleb128(seq) + ratchetPub[32] + uleb128(pn) + uleb128(n)
+type header struct {
+	seq uint64
+	pub *[32]byte
+	pn  uint64
+	n   uint64
+}
+
+type skippedIndex struct {
+	pub [32]byte
+	n   uint64
+}
+
+// skippedKeys holds the message keys skipped over, for messages that have not
+// arrived yet, in the order they are skipped.
+type skippedKeys struct {
+	keys map[skippedIndex]*memguard.LockedBuffer
+
+	// Oldest first
+	order []skippedIndex
+}
+
+func newSkippedKeys() *skippedKeys {
+	return &skippedKeys{
+		keys: make(map[skippedIndex]*memguard.LockedBuffer),
+	}
+}
+
+func (k *skippedKeys) len() int {
+	return len(k.keys)
+}
+
+func (k *skippedKeys) get(i skippedIndex) (*memguard.LockedBuffer, bool) {
+	mk, ok := k.keys[i]
+	return mk, ok
+}
+
+// add adds mk as the newest key.
+func (k *skippedKeys) add(i skippedIndex, mk *memguard.LockedBuffer) {
+	k.keys[i] = mk
+	k.order = append(k.order, i)
+}
+
+// take removes the key at i without destroying it, as it is being used.
+func (k *skippedKeys) take(i skippedIndex) {
+	delete(k.keys, i)
+	for j, v := range k.order {
+		if v == i {
+			k.order = append(k.order[:j], k.order[j+1:]...)
+			break
+		}
+	}
+}
+
+// merge moves the keys of other into k as the newest ones, then destroys the
+// oldest keys beyond maxSkip.
+func (k *skippedKeys) merge(other *skippedKeys) {
+	for _, i := range other.order {
+		k.add(i, other.keys[i])
+	}
+	other.keys = make(map[skippedIndex]*memguard.LockedBuffer)
+	other.order = nil
+
+	evict := len(k.order) - maxSkip
+	if evict <= 0 {
+		return
+	}
+	for _, i := range k.order[:evict] {
+		k.keys[i].Destroy()
+		delete(k.keys, i)
+	}
+	k.order = append(k.order[:0], k.order[evict:]...)
+}
+
+// destroyIf destroys and removes the keys at which f returns true.
+func (k *skippedKeys) destroyIf(f func(skippedIndex) bool) {
+	order := k.order[:0]
+	for _, i := range k.order {
+		if f(i) {
+			k.keys[i].Destroy()
+			delete(k.keys, i)
+		} else {
+			order = append(order, i)
+		}
+	}
+	k.order = order
+}
+
+func (k *skippedKeys) destroy() {
+	k.destroyIf(func(skippedIndex) bool { return true })
+}
+
+func (h *header) marshal() []byte {
+	ret := leb128.AppendUleb128(nil, h.seq)
+	ret = append(ret, h.pub[:]...)
+	ret = leb128.AppendUleb128(ret, h.pn)
+	ret = leb128.AppendUleb128(ret, h.n)
+
+	return ret
+}
+
+// parseHeader decodes the header from payload and returns it along with its
+// length.
+func parseHeader(payload []byte) (*header, int, error) {
+	h := new(header)
+	pos := 0
+
+	seq, n := leb128.DecodeUleb128(payload)
+	if n == 0 || int(n)+32 > len(payload) {
+		return nil, 0, errors.New("bad seq header")
+	}
+	h.seq = seq
+	pos += int(n)
+
+	h.pub = new([32]byte)
+	copy(h.pub[:], payload[pos:pos+32])
+	pos += 32
+
+	pn, n := leb128.DecodeUleb128(payload[pos:])
+	if n == 0 {
+		return nil, 0, errors.New("bad ratchet header")
+	}
+	h.pn = pn
+	pos += int(n)
+
+	cn, n := leb128.DecodeUleb128(payload[pos:])
+	if n == 0 {
+		return nil, 0, errors.New("bad ratchet header")
+	}
+	h.n = cn
+	pos += int(n)
+
+	return h, pos, nil
+}
+
+// array32 views the first 32 bytes of a locked buffer as an array, without
+// copying it out of the locked memory.
+func array32(b *memguard.LockedBuffer) *[32]byte {
+	return (*[32]byte)(unsafe.Pointer(&b.Buffer()[0]))
+}
+
+// dh computes the X25519 shared secret into a locked buffer, rejecting low
+// order public keys.
+func dh(pri *memguard.LockedBuffer, pub *[32]byte) (*memguard.LockedBuffer, error) {
+	out, err := memguard.NewMutable(32)
+	if err != nil {
+		return nil, err
+	}
+
+	curve25519.ScalarMult(array32(out), array32(pri), pub)
+
+	// Scalars are clamped to multiples of 8, so every low order point, and
+	// the zero point, gives an all-zero result. Such a result is known to
+	// everyone.
+	if subtle.ConstantTimeCompare(out.Buffer(), zeros32[:]) == 1 {
+		out.Destroy()
+		return nil, errors.New("low order public key")
+	}
+
+	if err := out.MakeImmutable(); err != nil {
+		out.Destroy()
+		return nil, err
+	}
+
+	return out, nil
+}
+
+// kdfRoot is KDF_RK of the Double Ratchet:
+//     rootKey', chainKey := HKDF-SHA256(salt = rootKey, ikm = dh)
+func kdfRoot(rootKey, dh *memguard.LockedBuffer) (*memguard.LockedBuffer, *memguard.LockedBuffer, error) {
+	buf := make([]byte, 64)
+	r := hkdf.New(sha256.New, dh.Buffer(), rootKey.Buffer(), ratchetInfo)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return nil, nil, err
+	}
+
+	// Both wipe the source
+	root, err := memguard.NewImmutableFromBytes(buf[:32])
+	if err != nil {
+		return nil, nil, err
+	}
+	chain, err := memguard.NewImmutableFromBytes(buf[32:])
+	if err != nil {
+		root.Destroy()
+		return nil, nil, err
+	}
+
+	return root, chain, nil
+}
+
+// kdfChain is KDF_CK of the Double Ratchet:
+//     messageKey := HMAC-SHA256(chainKey, 0x01)
+//     chainKey'  := HMAC-SHA256(chainKey, 0x02)
+// chainKey itself is left untouched.
+func kdfChain(chainKey *memguard.LockedBuffer) (*memguard.LockedBuffer, *memguard.LockedBuffer, error) {
+	mac := hmac.New(sha256.New, chainKey.Buffer())
+	mac.Write(messageKeyInput)
+	mk, err := memguard.NewImmutableFromBytes(mac.Sum(nil))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	mac.Reset()
+	mac.Write(chainKeyInput)
+	next, err := memguard.NewImmutableFromBytes(mac.Sum(nil))
+	if err != nil {
+		mk.Destroy()
+		return nil, nil, err
+	}
+
+	return mk, next, nil
+}
+
+// sealKey binds the header to the message key:
+//     key := HMAC-SHA256(messageKey, header)
+// secretbox has no associated data, so this is how the header gets
+// authenticated.
+func sealKey(mk *memguard.LockedBuffer, header []byte) (*memguard.LockedBuffer, error) {
+	mac := hmac.New(sha256.New, mk.Buffer())
+	mac.Write(header)
+
+	return memguard.NewImmutableFromBytes(mac.Sum(nil))
+}
+
+// initialChain derives the chain Bob uses before the first DH ratchet step.
+func initialChain(rootKey *memguard.LockedBuffer) (*memguard.LockedBuffer, error) {
+	mac := hmac.New(sha256.New, rootKey.Buffer())
+	mac.Write(initialChainInfo)
+
+	return memguard.NewImmutableFromBytes(mac.Sum(nil))
+}
+
+// ratchetSend performs the sending half of a DH ratchet step: a new ratchet key
+// pair is generated and a new sending chain is derived from it and the
+// partner's current ratchet public key.
+func (s *Session) ratchetSend() error {
+	pri, err := memguard.NewImmutableRandom(32)
+	if err != nil {
+		return err
+	}
+	pub := new([32]byte)
+	curve25519.ScalarBaseMult(pub, array32(pri))
+
+	shared, err := dh(pri, s.remotePub)
+	if err != nil {
+		pri.Destroy()
+		return err
+	}
+	defer shared.Destroy()
+
+	root, chain, err := kdfRoot(s.rootKey, shared)
+	if err != nil {
+		pri.Destroy()
+		return err
+	}
+
+	s.rootKey.Destroy()
+	s.rootKey = root
+	s.sendChain = chain
+	s.ratchetPri = pri
+	s.ratchetPub = pub
+	s.prevN, s.sendN = s.sendN, 0
+	s.chainStart = time.Now()
+	s.rekeyRequested = false
+
+	return nil
+}
+
+// pendingOpen holds the tentative ratchet state for an incoming message.
+// Nothing is written back to the session until the message is authenticated,
+// so a forged message can never corrupt the session.
+type pendingOpen struct {
+	mk *memguard.LockedBuffer
+
+	// Set if mk was taken from the skipped message keys.
+	usedSkipped *skippedIndex
+
+	// Newly skipped message keys.
+	skipped *skippedKeys
+
+	// Set if a DH ratchet step took place.
+	root      *memguard.LockedBuffer
+	remotePub *[32]byte
+
+	// The receiving chain after mk is derived.
+	chain *memguard.LockedBuffer
+	n     uint64
+}
+
+// receive derives the message key for h without modifying the session.
+func (s *Session) receive(h *header) (*pendingOpen, error) {
+	idx := skippedIndex{pub: *h.pub, n: h.n}
+	if mk, ok := s.skipped.get(idx); ok {
+		return &pendingOpen{mk: mk, usedSkipped: &idx}, nil
+	}
+
+	p := &pendingOpen{
+		skipped: newSkippedKeys(),
+	}
+
+	chain := s.recvChain
+	from := s.recvN
+	if s.remotePub == nil || !bytes.Equal(h.pub[:], s.remotePub[:]) {
+		// The partner has stepped the DH ratchet. Keep the remaining keys of
+		// the current receiving chain, then step ours.
+		if chain != nil {
+			rest, err := p.skip(chain, s.remotePub, from, h.pn)
+			if err != nil {
+				p.discard()
+				return nil, err
+			}
+			rest.Destroy()
+		}
+
+		if s.ratchetPri == nil {
+			p.discard()
+			return nil, errors.New("unexpected ratchet key")
+		}
+		shared, err := dh(s.ratchetPri, h.pub)
+		if err != nil {
+			p.discard()
+			return nil, err
+		}
+		p.root, chain, err = kdfRoot(s.rootKey, shared)
+		shared.Destroy()
+		if err != nil {
+			p.discard()
+			return nil, err
+		}
+		p.remotePub = h.pub
+		from = 0
+
+		defer chain.Destroy()
+	}
+
+	if chain == nil {
+		p.discard()
+		return nil, errors.New("no receiving chain")
+	}
+
+	// Skip up to the current message, then derive its key.
+	cur, err := p.skip(chain, h.pub, from, h.n)
+	if err != nil {
+		p.discard()
+		return nil, err
+	}
+	p.mk, p.chain, err = kdfChain(cur)
+	cur.Destroy()
+	if err != nil {
+		p.discard()
+		return nil, err
+	}
+	p.n = h.n + 1
+
+	return p, nil
+}
+
+// skip derives the message keys of chain from index from until index until,
+// and stores them in p.skipped. It returns a copy of the chain at index until.
+func (p *pendingOpen) skip(chain *memguard.LockedBuffer, pub *[32]byte, from, until uint64) (*memguard.LockedBuffer, error) {
+	if until < from {
+		return nil, errors.New("message key already used")
+	}
+	if until-from > maxSkip || p.skipped.len()+int(until-from) > maxSkip {
+		return nil, errors.New("too many skipped messages")
+	}
+
+	cur, err := memguard.Trim(chain, 0, 32)
+	if err != nil {
+		return nil, err
+	}
+
+	for n := from; n < until; n++ {
+		mk, next, err := kdfChain(cur)
+		cur.Destroy()
+		if err != nil {
+			return nil, err
+		}
+
+		p.skipped.add(skippedIndex{pub: *pub, n: n}, mk)
+		cur = next
+	}
+
+	return cur, nil
+}
+
+// commit writes the pending state back to the session. Keys that are no
+// longer needed are destroyed, so are the oldest skipped keys beyond maxSkip.
+func (p *pendingOpen) commit(s *Session) {
+	if p.usedSkipped != nil {
+		s.skipped.take(*p.usedSkipped)
+		return
+	}
+
+	s.skipped.merge(p.skipped)
+
+	if p.remotePub != nil {
+		s.rootKey.Destroy()
+		s.rootKey = p.root
+		s.remotePub = p.remotePub
+		s.awaitingStep = false
+
+		// The old ratchet key pair and the sending chain are done with. A
+		// fresh pair is generated on the next Seal.
+		if s.ratchetPri != nil {
+			s.ratchetPri.Destroy()
+			s.ratchetPri = nil
+		}
+		if s.sendChain != nil {
+			s.sendChain.Destroy()
+			s.sendChain = nil
+		}
+	}
+
+	if s.recvChain != nil {
+		s.recvChain.Destroy()
+	}
+	s.recvChain = p.chain
+	s.recvN = p.n
+}
+
+// discard destroys everything derived for the pending message, except for a
+// message key still owned by the session.
+func (p *pendingOpen) discard() {
+	if p.usedSkipped != nil {
+		return
+	}
+
+	if p.mk != nil {
+		p.mk.Destroy()
+	}
+	p.skipped.destroy()
+	if p.root != nil {
+		p.root.Destroy()
+	}
+	if p.chain != nil {
+		p.chain.Destroy()
+	}
+}
@@ -0,0 +1,150 @@
+package core
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/awnumar/memguard"
+)
+
+func TestRatchetOutOfOrder(t *testing.T) {
+	alice, bob := newPair(t)
+	defer alice.Destroy()
+	defer bob.Destroy()
+
+	// Two chains of Alice's, with a DH ratchet step in between.
+	var first, second [][]byte
+	for i := 0; i < 3; i++ {
+		first = append(first, mustSeal(t, alice, "first "+strconv.Itoa(i)))
+	}
+	mustOpen(t, bob, first[0], "first 0")
+	mustOpen(t, alice, mustSeal(t, bob, "reply"), "reply")
+	for i := 0; i < 3; i++ {
+		second = append(second, mustSeal(t, alice, "second "+strconv.Itoa(i)))
+	}
+
+	mustOpen(t, bob, second[2], "second 2")
+	mustOpen(t, bob, first[2], "first 2")
+	mustOpen(t, bob, second[0], "second 0")
+	mustOpen(t, bob, first[1], "first 1")
+	mustOpen(t, bob, second[1], "second 1")
+
+	if missing := bob.Missing(); len(missing) != 0 {
+		t.Fatalf("got missing %v, want none", missing)
+	}
+	if n := bob.skipped.len(); n != 0 {
+		t.Fatalf("%d skipped keys are left", n)
+	}
+
+	for _, payload := range append(first, second...) {
+		if _, err := bob.Open(payload); err != ErrDuplicate {
+			t.Fatalf("got %v, want ErrDuplicate", err)
+		}
+	}
+}
+
+func TestRatchetLoss(t *testing.T) {
+	alice, bob := newPair(t)
+	defer alice.Destroy()
+	defer bob.Destroy()
+
+	// Lose 3 runs of 400 messages, more than maxSkip in total, each run
+	// followed by one that arrives. Each run is fine, as only the oldest
+	// keys are forgotten.
+	const lost = 400
+	var oldest, newest []byte
+	for run := 0; run < 3; run++ {
+		for i := 0; i < lost; i++ {
+			payload := mustSeal(t, alice, "lost")
+			if run == 0 && i == 0 {
+				oldest = payload
+			}
+			newest = payload
+		}
+		mustOpen(t, bob, mustSeal(t, alice, "arrived"), "arrived")
+	}
+
+	if n := bob.skipped.len(); n != maxSkip {
+		t.Fatalf("%d skipped keys are kept, want %d", n, maxSkip)
+	}
+	if n := len(bob.Missing()); n > maxSkip {
+		t.Fatalf("%d missing seq numbers are kept, want at most %d", n, maxSkip)
+	}
+
+	// The newest lost message can still be opened, the oldest can't.
+	mustOpen(t, bob, newest, "lost")
+	if _, err := bob.Open(oldest); err == nil || err == ErrDuplicate {
+		t.Fatalf("got %v, want the oldest message rejected as too old", err)
+	}
+
+	// The session goes on.
+	mustOpen(t, bob, mustSeal(t, alice, "hello"), "hello")
+	mustOpen(t, alice, mustSeal(t, bob, "hi"), "hi")
+}
+
+func TestRatchetSkipCap(t *testing.T) {
+	alice, bob := newPair(t)
+	defer alice.Destroy()
+	defer bob.Destroy()
+
+	var payloads [][]byte
+	for i := 0; i < maxSkip+2; i++ {
+		payloads = append(payloads, mustSeal(t, alice, strconv.Itoa(i)))
+	}
+
+	// Opening the last one would skip more than maxSkip keys at once.
+	if _, err := bob.Open(payloads[maxSkip+1]); err == nil {
+		t.Fatal("skipped more than maxSkip keys")
+	}
+
+	// Nothing is stored for the rejected message.
+	if n := bob.skipped.len(); n != 0 {
+		t.Fatalf("%d skipped keys are kept", n)
+	}
+	mustOpen(t, bob, payloads[maxSkip], strconv.Itoa(maxSkip))
+	mustOpen(t, bob, payloads[0], "0")
+}
+
+func TestSkippedKeysEviction(t *testing.T) {
+	keys := newSkippedKeys()
+	defer keys.destroy()
+
+	add := func(k *skippedKeys, from, until uint64) {
+		for n := from; n < until; n++ {
+			mk, err := memguard.NewImmutableRandom(32)
+			if err != nil {
+				t.Fatal(err)
+			}
+			k.add(skippedIndex{n: n}, mk)
+		}
+	}
+
+	add(keys, 0, maxSkip-1)
+	keys.take(skippedIndex{n: 5})
+
+	more := newSkippedKeys()
+	add(more, maxSkip-1, maxSkip+2)
+	keys.merge(more)
+
+	if keys.len() != maxSkip || len(keys.order) != maxSkip {
+		t.Fatalf("%d keys and %d in order are kept, want %d", keys.len(), len(keys.order), maxSkip)
+	}
+	if more.len() != 0 {
+		t.Fatal("merged keys are left behind")
+	}
+
+	// The oldest one is gone, along with the one taken.
+	for _, n := range []uint64{0, 5} {
+		if _, ok := keys.get(skippedIndex{n: n}); ok {
+			t.Fatalf("key %d is kept", n)
+		}
+	}
+	for _, n := range []uint64{1, 4, 6, maxSkip + 1} {
+		if _, ok := keys.get(skippedIndex{n: n}); !ok {
+			t.Fatalf("key %d is evicted", n)
+		}
+	}
+	if keys.order[0].n != 1 || keys.order[maxSkip-1].n != maxSkip+1 {
+		t.Fatal("keys are out of order")
+	}
+}
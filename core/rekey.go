@@ -0,0 +1,140 @@
+package core
+
+import (
+	"errors"
+	"time"
+
+	"golang.org/x/crypto/sha3"
+)
+
+// Types of a sealed message, the first byte of the sealed plain text.
+const (
+	typeData = iota
+	typeRekey
+	typeRekeyAck
+	typeWrap
+)
+
+var (
+	// DefaultRekeyMessages and DefaultRekeyInterval is when a rekey is due
+	// unless told otherwise by SetRekeyPolicy.
+	DefaultRekeyMessages uint64 = 100
+	DefaultRekeyInterval        = time.Hour
+
+	// ErrRekeyRequest is returned by Open when the message is a rekey request
+	// from the partner, rather than an error. It has been processed, and the
+	// partner is waiting for the reply made by AckRekey.
+	ErrRekeyRequest = errors.New("open: partner asks for a rekey")
+
+	// ErrRekeyAck is returned by Open when the message is the partner's reply
+	// to our rekey request, rather than an error. Nothing else is to be done,
+	// our next message will be sealed with a fresh key.
+	ErrRekeyAck = errors.New("open: partner has replied to the rekey")
+)
+
+// SetRekeyPolicy sets after how many messages, or how long, sealed under the
+// same sending chain a rekey is due. Zero disables either limit.
+//
+// A Noise session can't be rekeyed, its policy is always disabled.
+func (s *Session) SetRekeyPolicy(messages uint64, interval time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.noise != nil && (messages > 0 || interval > 0) {
+		return errors.New("rekey: not supported by a Noise session")
+	}
+
+	s.rekeyMessages = messages
+	s.rekeyInterval = interval
+
+	return nil
+}
+
+// RekeyPolicy returns the limits set by SetRekeyPolicy.
+func (s *Session) RekeyPolicy() (uint64, time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.rekeyMessages, s.rekeyInterval
+}
+
+// RekeyDue reports whether the current sending chain has protected enough
+// messages, or has been used long enough, that it should be replaced.
+//
+// The Double Ratchet replaces the keys on every turn of the conversation, so
+// this only happens when one side keeps talking. A rekey then asks the partner
+// to take a turn: the reply carries a fresh DH ratchet key, from which both
+// sides derive a new root key, new chains and new nonce seeds.
+func (s *Session) RekeyDue() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.sendChain == nil || s.rekeyRequested {
+		return false
+	}
+
+	if s.rekeyMessages > 0 && s.sendN >= s.rekeyMessages {
+		return true
+	}
+	if s.rekeyInterval > 0 && time.Since(s.chainStart) >= s.rekeyInterval {
+		return true
+	}
+
+	return false
+}
+
+// Rekey seals a rekey request to be sent to the partner. A rekey stays due
+// until RekeySent is called, so a request that fails to go out is made again.
+func (s *Session) Rekey() ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.seq == 0 {
+		return nil, errors.New("rekey: no shared key")
+	}
+	if s.noise != nil {
+		return nil, errors.New("rekey: not supported by a Noise session")
+	}
+
+	return s.seal(typeRekey, nil)
+}
+
+// RekeySent records that the request sealed by Rekey has been sent, so no
+// rekey is due until the partner replies.
+func (s *Session) RekeySent() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.rekeyRequested = true
+}
+
+// AckRekey seals the reply to the partner's rekey request. The request is an
+// ordinary message under the partner's current chain, the reply is what steps
+// the ratchet: unless we have already sent under the partner's current ratchet
+// key, it is sealed under a new sending chain from a fresh ratchet key pair,
+// and the partner's next message follows with one of its own.
+func (s *Session) AckRekey() ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.seq == 0 {
+		return nil, errors.New("rekey: no shared key")
+	}
+	if s.noise != nil {
+		return nil, errors.New("rekey: not supported by a Noise session")
+	}
+
+	return s.seal(typeRekeyAck, nil)
+}
+
+// chainNonce computes the nonce of a message sealed under the chain of the
+// ratchet key pub. Each chain has a nonce seed of its own,
+//     chainSeed := SHAKE128(nonceSeed + ratchetPub)
+// so a fresh ratchet key gives a fresh nonce seed as well.
+func (s *Session) chainNonce(pub *[32]byte, seq uint64, isAlice bool) *[24]byte {
+	seed := new([24]byte)
+	h := sha3.NewShake128()
+	h.Write(s.nonceSeed[:])
+	h.Write(pub[:])
+	h.Read(seed[:])
+
+	return computeNounce(seed, seq, isAlice)
+}
@@ -0,0 +1,100 @@
+package core
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/awnumar/memguard"
+)
+
+func TestRekey(t *testing.T) {
+	alice, bob := newPair(t)
+	defer alice.Destroy()
+	defer bob.Destroy()
+
+	alice.SetRekeyPolicy(3, 0)
+	if messages, interval := alice.RekeyPolicy(); messages != 3 || interval != 0 {
+		t.Fatalf("got policy %d, %v", messages, interval)
+	}
+
+	for i := 0; i < 3; i++ {
+		if alice.RekeyDue() {
+			t.Fatalf("a rekey is due after %d messages", i)
+		}
+		mustOpen(t, bob, mustSeal(t, alice, "hello"), "hello")
+	}
+	if !alice.RekeyDue() {
+		t.Fatal("no rekey is due after 3 messages")
+	}
+
+	request, err := alice.Rekey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !alice.RekeyDue() {
+		t.Fatal("no rekey is due before the request is sent")
+	}
+	alice.RekeySent()
+	if alice.RekeyDue() {
+		t.Fatal("a rekey is still due once requested")
+	}
+	if _, err := bob.Open(request); err != ErrRekeyRequest {
+		t.Fatalf("got %v, want ErrRekeyRequest", err)
+	}
+
+	// A message sealed before the reply still goes through.
+	late := mustSeal(t, alice, "late")
+
+	ack, err := bob.AckRekey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := alice.Open(ack); err != ErrRekeyAck {
+		t.Fatalf("got %v, want ErrRekeyAck", err)
+	}
+	if alice.RekeyDue() {
+		t.Fatal("a rekey is due right after one")
+	}
+
+	mustOpen(t, bob, mustSeal(t, alice, "fresh"), "fresh")
+	mustOpen(t, bob, late, "late")
+}
+
+func TestRekeyInterval(t *testing.T) {
+	alice, bob := newPair(t)
+	defer alice.Destroy()
+	defer bob.Destroy()
+
+	alice.SetRekeyPolicy(0, time.Hour)
+	mustOpen(t, bob, mustSeal(t, alice, "hello"), "hello")
+	if alice.RekeyDue() {
+		t.Fatal("a rekey is due too early")
+	}
+
+	alice.mu.Lock()
+	alice.chainStart = time.Now().Add(-2 * time.Hour)
+	alice.mu.Unlock()
+	if !alice.RekeyDue() {
+		t.Fatal("no rekey is due after the interval")
+	}
+}
+
+func TestSeqExhausted(t *testing.T) {
+	alice, bob := newPair(t)
+	defer alice.Destroy()
+	defer bob.Destroy()
+
+	alice.mu.Lock()
+	alice.seq = math.MaxUint64
+	alice.mu.Unlock()
+
+	plain, _ := memguard.NewImmutableFromBytes([]byte("hello"))
+	defer plain.Destroy()
+	if _, err := alice.Seal(plain); err == nil {
+		t.Fatal("sealed with an exhausted seq number")
+	}
+	if _, err := alice.Rekey(); err == nil {
+		t.Fatal("a rekey is sealed with an exhausted seq number")
+	}
+}
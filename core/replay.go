@@ -0,0 +1,72 @@
+package core
+
+import (
+	"errors"
+	"sort"
+)
+
+// ErrDuplicate is returned by Open when a message with the same seq number has
+// already been decrypted.
+var ErrDuplicate = errors.New("open: duplicated message")
+
+// checkSeq rejects seq numbers that can never be valid, before any key is
+// derived for them. Only the last maxSkip seq numbers are remembered, anything
+// older is rejected as too old.
+func (s *Session) checkSeq(seq uint64) error {
+	if seq == 0 {
+		return errors.New("open: bad seq header")
+	}
+
+	if seq+maxSkip < s.recvSeq {
+		return errors.New("open: message too old")
+	}
+
+	if seq <= s.recvSeq {
+		if _, ok := s.missing[seq]; !ok {
+			return ErrDuplicate
+		}
+		return nil
+	}
+
+	if seq-s.recvSeq > maxSkip+1 {
+		return errors.New("open: too many skipped messages")
+	}
+
+	return nil
+}
+
+// markSeq records seq as decrypted. It must only be called after the message
+// has been authenticated.
+func (s *Session) markSeq(seq uint64) {
+	if seq <= s.recvSeq {
+		delete(s.missing, seq)
+		return
+	}
+
+	for i := s.recvSeq + 1; i < seq; i++ {
+		s.missing[i] = struct{}{}
+	}
+	s.recvSeq = seq
+
+	// Forget those that checkSeq rejects from now on.
+	for i := range s.missing {
+		if i+maxSkip < seq {
+			delete(s.missing, i)
+		}
+	}
+}
+
+// Missing returns the seq numbers of partner's messages that have been skipped
+// over and never decrypted, among the last maxSkip ones, in ascending order.
+func (s *Session) Missing() []uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ret := make([]uint64, 0, len(s.missing))
+	for seq := range s.missing {
+		ret = append(ret, seq)
+	}
+	sort.Slice(ret, func(i, j int) bool { return ret[i] < ret[j] })
+
+	return ret
+}
@@ -0,0 +1,62 @@
+package core
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMissing(t *testing.T) {
+	alice, bob := newPair(t)
+	defer alice.Destroy()
+	defer bob.Destroy()
+
+	var payloads [][]byte
+	for i := 0; i < 5; i++ {
+		payloads = append(payloads, mustSeal(t, alice, "hello"))
+	}
+
+	mustOpen(t, bob, payloads[4], "hello")
+	if got := bob.Missing(); !reflect.DeepEqual(got, []uint64{1, 2, 3, 4}) {
+		t.Fatalf("got missing %v", got)
+	}
+
+	mustOpen(t, bob, payloads[2], "hello")
+	mustOpen(t, bob, payloads[0], "hello")
+	if got := bob.Missing(); !reflect.DeepEqual(got, []uint64{2, 4}) {
+		t.Fatalf("got missing %v", got)
+	}
+
+	// A message opened late is a duplicate from then on.
+	if _, err := bob.Open(payloads[2]); err != ErrDuplicate {
+		t.Fatalf("got %v, want ErrDuplicate", err)
+	}
+}
+
+func TestCheckSeq(t *testing.T) {
+	s := &Session{missing: make(map[uint64]struct{})}
+	s.markSeq(5)
+	s.markSeq(maxSkip + 10)
+
+	for _, c := range []struct {
+		seq uint64
+		ok  bool
+	}{
+		{0, false},
+		{5, false},
+		{maxSkip + 10, false},
+		{maxSkip + 9, true},
+		{10, true},
+		{9, false},
+		{maxSkip + 11, true},
+		{2*maxSkip + 11, true},
+		{2*maxSkip + 12, false},
+	} {
+		if err := s.checkSeq(c.seq); (err == nil) != c.ok {
+			t.Errorf("seq %d: got %v", c.seq, err)
+		}
+	}
+
+	if _, ok := s.missing[9]; ok {
+		t.Fatal("a seq number older than maxSkip is kept")
+	}
+}
@@ -0,0 +1,342 @@
+package core
+
+import (
+	"errors"
+	"time"
+
+	"ekyu.moe/leb128"
+	"github.com/awnumar/memguard"
+)
+
+const stateVersion = 6
+
+// ErrAwaitingPartner is returned when sealing with an imported session that
+// must hear from the partner first, see Export.
+var ErrAwaitingPartner = errors.New("seal: the session has been resumed, wait for a message from your partner")
+
+// Export serializes the full state of an established session into locked
+// memory, so that it can be resumed later by Import.
+//
+// Nothing in the state can tell a copy of it, or a backup restored, from the
+// original, so the state itself must be safe to resume more than once. The
+// sending chain is therefore never exported. Once imported, a session seals
+// under a new chain from a fresh ratchet key pair, of its own and random, so
+// two copies never share message keys or nonces. If a sending chain was in
+// use, the partner may already have moved past the ratchet key it answers to,
+// so the imported session refuses to seal with ErrAwaitingPartner until a
+// message from the partner steps the DH ratchet.
+//
+// A stale copy can still open messages that the original has already opened,
+// and its messages may reuse seq numbers that the partner then rejects, but it
+// never reuses keys. The session should be destroyed right after Export all
+// the same.
+//
+// The cipher suites offered and the rekey policy are kept as well.
+func (s *Session) Export() (*memguard.LockedBuffer, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.seq == 0 {
+		return nil, errors.New("export: no shared key")
+	}
+	if s.noise != nil {
+		return nil, errors.New("export: not supported by a Noise session")
+	}
+
+	// Measure first, then write into locked memory.
+	w := new(stateWriter)
+	s.writeState(w)
+
+	state, err := memguard.NewMutable(w.pos)
+	if err != nil {
+		return nil, err
+	}
+
+	w = &stateWriter{buf: state.Buffer()}
+	s.writeState(w)
+
+	if err := state.MakeImmutable(); err != nil {
+		state.Destroy()
+		return nil, err
+	}
+
+	return state, nil
+}
+
+// Import resumes a session exported by Export.
+func Import(state *memguard.LockedBuffer) (*Session, error) {
+	r := &stateReader{buf: state.Buffer()}
+	s := &Session{
+		chainStart: time.Now(),
+
+		skipped: newSkippedKeys(),
+		missing: make(map[uint64]struct{}),
+	}
+
+	if err := s.readState(r); err != nil {
+		s.Destroy()
+		return nil, errors.New("import: " + err.Error())
+	}
+
+	return s, nil
+}
+
+// AwaitingPartner reports whether the session refuses to seal until a message
+// from the partner arrives, see Export.
+func (s *Session) AwaitingPartner() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.awaitingStep
+}
+
+// Format:
+//     version[1] + isAlice[1] + suite[1] +
+//     uleb128(len(suites)) + suite[1]... +
+//     uleb128(rekeyMessages, rekeyInterval in seconds) +
+//     uleb128(seq, sendN, recvN, prevN, recvSeq) +
+//     nonceSeed[24] + pub[32] + peerPub[32] + rootKey[32] +
+//     broadcastSend[32] + broadcastRecv[32] +
+//     optional(ratchetPub[32] + ratchetPri[32]) + optional(remotePub[32]) +
+//     awaitingStep[1] + optional(recvChain[32]) +
+//     uleb128(len(missing)) + uleb128(seq)... +
+//     uleb128(len(skipped)) + (pub[32] + uleb128(n) + messageKey[32])...
+// where skipped keys are oldest first, and optional(x) is a byte 0 for absent,
+// or 1 followed by x.
+func (s *Session) writeState(w *stateWriter) {
+	w.byte(stateVersion)
+	if s.isAlice {
+		w.byte(1)
+	} else {
+		w.byte(0)
+	}
+	w.byte(byte(s.suite))
+
+	w.uint(uint64(len(s.suites)))
+	for _, c := range s.suites {
+		w.byte(byte(c))
+	}
+
+	w.uint(s.rekeyMessages)
+	w.uint(uint64(s.rekeyInterval / time.Second))
+
+	w.uint(s.seq)
+	w.uint(s.sendN)
+	w.uint(s.recvN)
+	w.uint(s.prevN)
+	w.uint(s.recvSeq)
+
+	w.bytes(s.nonceSeed[:])
+	w.bytes(s.pub[:])
+	w.bytes(s.peerPub[:])
+	w.bytes(s.rootKey.Buffer())
+	w.bytes(s.broadcastSend.Buffer())
+	w.bytes(s.broadcastRecv.Buffer())
+
+	if w.present(s.ratchetPri != nil) {
+		w.bytes(s.ratchetPub[:])
+		w.bytes(s.ratchetPri.Buffer())
+	}
+	if w.present(s.remotePub != nil) {
+		w.bytes(s.remotePub[:])
+	}
+	// The sending chain is left out, see Export.
+	w.present(s.sendChain != nil || s.awaitingStep)
+	if w.present(s.recvChain != nil) {
+		w.bytes(s.recvChain.Buffer())
+	}
+
+	w.uint(uint64(len(s.missing)))
+	for seq := range s.missing {
+		w.uint(seq)
+	}
+
+	w.uint(uint64(s.skipped.len()))
+	for _, i := range s.skipped.order {
+		w.bytes(i.pub[:])
+		w.uint(i.n)
+		w.bytes(s.skipped.keys[i].Buffer())
+	}
+}
+
+func (s *Session) readState(r *stateReader) error {
+	if r.byte() != stateVersion {
+		return errors.New("unsupported version")
+	}
+	s.isAlice = r.byte() == 1
+	s.suite = Suite(r.byte())
+	if !s.suite.supported() {
+		return errors.New("unknown cipher suite")
+	}
+
+	s.suites = nil
+	for n := r.uint(); n > 0 && r.err == nil; n-- {
+		c := Suite(r.byte())
+		if !c.supported() {
+			return errors.New("unknown cipher suite")
+		}
+		s.suites = append(s.suites, c)
+	}
+
+	s.rekeyMessages = r.uint()
+	s.rekeyInterval = time.Duration(r.uint()) * time.Second
+
+	s.seq = r.uint()
+	s.sendN = r.uint()
+	s.recvN = r.uint()
+	s.prevN = r.uint()
+	s.recvSeq = r.uint()
+
+	s.nonceSeed = new([24]byte)
+	r.read(s.nonceSeed[:])
+	s.pub = r.array()
+	s.peerPub = r.array()
+	s.rootKey = r.key()
+	s.broadcastSend = r.key()
+	s.broadcastRecv = r.key()
+
+	if r.present() {
+		s.ratchetPub = r.array()
+		s.ratchetPri = r.key()
+	}
+	if r.present() {
+		s.remotePub = r.array()
+	}
+	s.awaitingStep = r.present()
+	if r.present() {
+		s.recvChain = r.key()
+	}
+
+	for n := r.uint(); n > 0 && r.err == nil; n-- {
+		s.missing[r.uint()] = struct{}{}
+	}
+
+	for n := r.uint(); n > 0 && r.err == nil; n-- {
+		var i skippedIndex
+		r.read(i.pub[:])
+		i.n = r.uint()
+		if mk := r.key(); mk != nil {
+			s.skipped.add(i, mk)
+		}
+	}
+
+	if r.err == nil && r.pos != len(r.buf) {
+		return errors.New("trailing data")
+	}
+	if r.err == nil && s.seq == 0 {
+		return errors.New("no shared key")
+	}
+	if r.err == nil && s.awaitingStep && s.ratchetPri == nil {
+		return errors.New("no ratchet key pair")
+	}
+
+	return r.err
+}
+
+// stateWriter only measures the length if buf is nil.
+type stateWriter struct {
+	buf []byte
+	pos int
+}
+
+func (w *stateWriter) bytes(b []byte) {
+	if w.buf != nil {
+		copy(w.buf[w.pos:], b)
+	}
+	w.pos += len(b)
+}
+
+func (w *stateWriter) byte(b byte) {
+	w.bytes([]byte{b})
+}
+
+func (w *stateWriter) uint(v uint64) {
+	w.bytes(leb128.AppendUleb128(nil, v))
+}
+
+func (w *stateWriter) present(ok bool) bool {
+	if ok {
+		w.byte(1)
+	} else {
+		w.byte(0)
+	}
+
+	return ok
+}
+
+// stateReader remembers the first error, after which it reads zeros.
+type stateReader struct {
+	buf []byte
+	pos int
+	err error
+}
+
+func (r *stateReader) read(b []byte) {
+	if r.err != nil {
+		return
+	}
+	if len(r.buf)-r.pos < len(b) {
+		r.err = errors.New("truncated state")
+		return
+	}
+
+	copy(b, r.buf[r.pos:])
+	r.pos += len(b)
+}
+
+func (r *stateReader) byte() byte {
+	b := make([]byte, 1)
+	r.read(b)
+	return b[0]
+}
+
+func (r *stateReader) uint() uint64 {
+	if r.err != nil {
+		return 0
+	}
+
+	v, n := leb128.DecodeUleb128(r.buf[r.pos:])
+	if n == 0 {
+		r.err = errors.New("bad integer")
+		return 0
+	}
+	r.pos += int(n)
+
+	return v
+}
+
+func (r *stateReader) array() *[32]byte {
+	ret := new([32]byte)
+	r.read(ret[:])
+	return ret
+}
+
+// key copies the next 32 bytes into locked memory.
+func (r *stateReader) key() *memguard.LockedBuffer {
+	if r.err != nil {
+		return nil
+	}
+	if len(r.buf)-r.pos < 32 {
+		r.err = errors.New("truncated state")
+		return nil
+	}
+
+	key, err := memguard.NewMutable(32)
+	if err != nil {
+		r.err = err
+		return nil
+	}
+	copy(key.Buffer(), r.buf[r.pos:r.pos+32])
+	r.pos += 32
+
+	if err := key.MakeImmutable(); err != nil {
+		key.Destroy()
+		r.err = err
+		return nil
+	}
+
+	return key
+}
+
+func (r *stateReader) present() bool {
+	return r.byte() == 1
+}
@@ -0,0 +1,195 @@
+package core
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/awnumar/memguard"
+)
+
+// resume exports s, destroys it and imports it back.
+func resume(t *testing.T, s *Session) *Session {
+	t.Helper()
+
+	state, err := s.Export()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer state.Destroy()
+	s.Destroy()
+
+	ret, err := Import(state)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return ret
+}
+
+func TestExportImport(t *testing.T) {
+	alice, _ := NewSession()
+	bob, _ := NewSession()
+	suites := []Suite{XChaCha20Poly1305, Secretbox}
+	if err := alice.SetSuites(suites); err != nil {
+		t.Fatal(err)
+	}
+	if err := bob.SetSuites(AllSuites()); err != nil {
+		t.Fatal(err)
+	}
+	alice.SetRekeyPolicy(42, 90*time.Minute)
+	if err := computePair(alice, bob); err != nil {
+		t.Fatal(err)
+	}
+	defer bob.Destroy()
+
+	auth := alice.AuthString()
+	mustOpen(t, bob, mustSeal(t, alice, "hello"), "hello")
+	reply := mustSeal(t, bob, "hi")
+	late := mustSeal(t, bob, "late")
+	mustOpen(t, alice, mustSeal(t, bob, "bye"), "bye")
+
+	alice = resume(t, alice)
+	defer alice.Destroy()
+
+	if !reflect.DeepEqual(alice.Suites(), suites) {
+		t.Fatalf("got suites %v, want %v", alice.Suites(), suites)
+	}
+	if alice.Suite() != XChaCha20Poly1305 {
+		t.Fatalf("got suite %v", alice.Suite())
+	}
+	if messages, interval := alice.RekeyPolicy(); messages != 42 || interval != 90*time.Minute {
+		t.Fatalf("got rekey policy %d, %v", messages, interval)
+	}
+	if !reflect.DeepEqual(alice.AuthString(), auth) {
+		t.Fatal("auth string changed")
+	}
+
+	// Skipped keys are kept, in order.
+	if missing := alice.Missing(); !reflect.DeepEqual(missing, []uint64{1, 2}) {
+		t.Fatalf("got missing %v", missing)
+	}
+	if n := alice.skipped.len(); n != 2 || alice.skipped.order[0].n > alice.skipped.order[1].n {
+		t.Fatal("skipped keys are lost or out of order")
+	}
+
+	mustOpen(t, alice, late, "late")
+	mustOpen(t, alice, reply, "hi")
+	mustOpen(t, bob, mustSeal(t, alice, "again"), "again")
+	mustOpen(t, alice, mustSeal(t, bob, "welcome back"), "welcome back")
+
+	// So are the broadcast keys.
+	plain, _ := memguard.NewImmutableFromBytes([]byte("everyone"))
+	payload, err := SealBroadcast([]*Session{bob}, plain)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mustOpen(t, alice, payload, "everyone")
+}
+
+func TestExportBeforeCompute(t *testing.T) {
+	s, _ := NewSession()
+	defer s.Destroy()
+
+	if _, err := s.Export(); err == nil {
+		t.Fatal("exported a session without a shared key")
+	}
+}
+
+func TestImportBad(t *testing.T) {
+	alice, bob := newPair(t)
+	defer bob.Destroy()
+
+	state, err := alice.Export()
+	if err != nil {
+		t.Fatal(err)
+	}
+	alice.Destroy()
+	good := append([]byte(nil), state.Buffer()...)
+	state.Destroy()
+
+	bad := map[string][]byte{
+		"zero":      {0},
+		"version":   append([]byte{stateVersion + 1}, good[1:]...),
+		"suite":     append([]byte{good[0], good[1], 0xff}, good[3:]...),
+		"truncated": good[:len(good)-1],
+		"trailing":  append(append([]byte(nil), good...), 0),
+	}
+	for name, b := range bad {
+		// The source is wiped, so it takes a copy.
+		buf, err := memguard.NewImmutableFromBytes(append([]byte(nil), b...))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s, err := Import(buf); err == nil {
+			s.Destroy()
+			t.Errorf("%s state is imported", name)
+		}
+		buf.Destroy()
+	}
+
+	buf, _ := memguard.NewImmutableFromBytes(good)
+	defer buf.Destroy()
+	s, err := Import(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Destroy()
+
+	// Either may have to wait for the other, see TestImportAwaitsPartner.
+	mustOpen(t, s, mustSeal(t, bob, "hello"), "hello")
+	mustOpen(t, bob, mustSeal(t, s, "hi"), "hi")
+}
+
+func TestImportAwaitsPartner(t *testing.T) {
+	alice, bob := newPair(t)
+	defer alice.Destroy()
+
+	mustOpen(t, bob, mustSeal(t, alice, "hello"), "hello")
+	hi := mustSeal(t, bob, "hi")
+
+	// Bob has a sending chain in use, which is not exported. The state is
+	// imported twice, as if a copy had been kept.
+	state, err := bob.Export()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer state.Destroy()
+	bob.Destroy()
+
+	copies := make([]*Session, 2)
+	for i := range copies {
+		if copies[i], err = Import(state); err != nil {
+			t.Fatal(err)
+		}
+		defer copies[i].Destroy()
+
+		if !copies[i].AwaitingPartner() {
+			t.Fatal("imported session does not wait for the partner")
+		}
+		plain, _ := memguard.NewImmutableFromBytes([]byte("too early"))
+		if _, err := copies[i].Seal(plain); err != ErrAwaitingPartner {
+			t.Fatalf("got %v, want ErrAwaitingPartner", err)
+		}
+	}
+
+	mustOpen(t, alice, hi, "hi")
+	again := mustSeal(t, alice, "again")
+
+	pubs := make([][32]byte, len(copies))
+	for i, s := range copies {
+		mustOpen(t, s, again, "again")
+		if s.AwaitingPartner() {
+			t.Fatal("session still waits after the partner stepped the ratchet")
+		}
+
+		h, _, err := parseHeader(mustSeal(t, s, "welcome back"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		pubs[i] = *h.pub
+	}
+	if pubs[0] == pubs[1] {
+		t.Fatal("copies of the state seal under the same ratchet key")
+	}
+}
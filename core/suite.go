@@ -0,0 +1,192 @@
+package core
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha256"
+	"errors"
+
+	"github.com/awnumar/memguard"
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/nacl/secretbox"
+)
+
+// Suite is an AEAD cipher suite used to seal messages.
+type Suite byte
+
+// The numbers are sent over the wire, never change them.
+const (
+	// XSalsa20-Poly1305, the default.
+	Secretbox Suite = iota
+	AES256GCM
+	XChaCha20Poly1305
+)
+
+var (
+	// From the strongest to the weakest. All of them have a 256 bits key and
+	// a 128 bits tag, XChaCha20-Poly1305 comes first for its random-safe nonce
+	// and constant time software implementation, secretbox last for lacking
+	// associated data.
+	suitePreference = []Suite{XChaCha20Poly1305, AES256GCM, Secretbox}
+
+	suiteBindingInfo = []byte("soda suites")
+
+	// DefaultSuites is what a session offers unless told otherwise.
+	DefaultSuites = []Suite{Secretbox}
+)
+
+// AllSuites returns every supported suite, the strongest first.
+func AllSuites() []Suite {
+	return append([]Suite(nil), suitePreference...)
+}
+
+func (c Suite) String() string {
+	switch c {
+	case Secretbox:
+		return "XSalsa20-Poly1305"
+	case AES256GCM:
+		return "AES-256-GCM"
+	case XChaCha20Poly1305:
+		return "XChaCha20-Poly1305"
+	default:
+		return "unknown"
+	}
+}
+
+func (c Suite) supported() bool {
+	return c <= XChaCha20Poly1305
+}
+
+// seal appends the sealed plain to dst. ad is authenticated too, which
+// secretbox can't do by itself, so the caller must also bind ad to key.
+func (c Suite) seal(dst []byte, key *[32]byte, nonce *[24]byte, plain, ad []byte) ([]byte, error) {
+	if c == Secretbox {
+		return secretbox.Seal(dst, plain, nonce, key), nil
+	}
+
+	aead, n, err := c.aead(key, nonce)
+	if err != nil {
+		return nil, err
+	}
+
+	return aead.Seal(dst, n, plain, ad), nil
+}
+
+func (c Suite) open(key *[32]byte, nonce *[24]byte, sealed, ad []byte) ([]byte, bool) {
+	if c == Secretbox {
+		return secretbox.Open(nil, sealed, nonce, key)
+	}
+
+	aead, n, err := c.aead(key, nonce)
+	if err != nil {
+		return nil, false
+	}
+
+	plain, err := aead.Open(nil, n, sealed, ad)
+	return plain, err == nil
+}
+
+// aead returns the cipher.AEAD of the suite and the nonce fitting it. For
+// AES-256-GCM the 24 bytes nonce is folded into 12 bytes,
+//     nonce12[i] := nonce[i] XOR nonce[i+12]
+// which is still unique per seq for both Alice and Bob.
+func (c Suite) aead(key *[32]byte, nonce *[24]byte) (cipher.AEAD, []byte, error) {
+	switch c {
+	case XChaCha20Poly1305:
+		aead, err := chacha20poly1305.NewX(key[:])
+		return aead, nonce[:], err
+
+	case AES256GCM:
+		block, err := aes.NewCipher(key[:])
+		if err != nil {
+			return nil, nil, err
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		n := make([]byte, 12)
+		for i := range n {
+			n[i] = nonce[i] ^ nonce[i+12]
+		}
+		return aead, n, nil
+	}
+
+	return nil, nil, errors.New("unknown cipher suite")
+}
+
+// SetSuites sets the suites offered to the partner. It must be called before
+// Compute.
+func (s *Session) SetSuites(suites []Suite) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.seq != 0 {
+		return errors.New("suites: already have shared secret")
+	}
+	if len(suites) == 0 {
+		return errors.New("suites: at least one suite is required")
+	}
+	for _, c := range suites {
+		if !c.supported() {
+			return errors.New("suites: unknown cipher suite")
+		}
+	}
+
+	s.suites = append([]Suite(nil), suites...)
+	return nil
+}
+
+// Suites returns the suites offered to the partner.
+func (s *Session) Suites() []Suite {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Suite(nil), s.suites...)
+}
+
+// Suite returns the suite agreed on with the partner.
+func (s *Session) Suite() Suite {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.suite
+}
+
+// negotiate picks the strongest suite offered by both sides.
+func negotiate(ours, theirs []Suite) (Suite, error) {
+	for _, c := range suitePreference {
+		if containsSuite(ours, c) && containsSuite(theirs, c) {
+			return c, nil
+		}
+	}
+
+	return 0, errors.New("no cipher suite in common")
+}
+
+// bindSuites mixes the suites offered by both sides into the root key, so that
+// a man in the middle downgrading the suite ends up with mismatched keys.
+//     root' := HMAC-SHA256(root, "soda suites" + len(AliceSuites) +
+//                          AliceSuites + len(BobSuites) + BobSuites)
+func bindSuites(root *memguard.LockedBuffer, alice, bob []Suite) (*memguard.LockedBuffer, error) {
+	mac := hmac.New(sha256.New, root.Buffer())
+	mac.Write(suiteBindingInfo)
+	for _, suites := range [][]Suite{alice, bob} {
+		mac.Write([]byte{byte(len(suites))})
+		for _, c := range suites {
+			mac.Write([]byte{byte(c)})
+		}
+	}
+
+	return memguard.NewImmutableFromBytes(mac.Sum(nil))
+}
+
+func containsSuite(suites []Suite, c Suite) bool {
+	for _, v := range suites {
+		if v == c {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,113 @@
+package core
+
+import (
+	"testing"
+)
+
+// newSuitePair returns two sessions offering the suites a and b, which have
+// exchanged hellos with each other.
+func newSuitePair(t *testing.T, a, b []Suite) (*Session, *Session) {
+	t.Helper()
+
+	alice, _ := NewSession()
+	bob, _ := NewSession()
+	if err := alice.SetSuites(a); err != nil {
+		t.Fatal(err)
+	}
+	if err := bob.SetSuites(b); err != nil {
+		t.Fatal(err)
+	}
+	if err := computePair(alice, bob); err != nil {
+		t.Fatal(err)
+	}
+
+	return alice, bob
+}
+
+func TestSuites(t *testing.T) {
+	for _, c := range AllSuites() {
+		alice, bob := newSuitePair(t, []Suite{Secretbox, c}, AllSuites())
+		if alice.Suite() != c || bob.Suite() != c {
+			t.Fatalf("%v: got %v and %v", c, alice.Suite(), bob.Suite())
+		}
+
+		for i := 0; i < 3; i++ {
+			mustOpen(t, bob, mustSeal(t, alice, "hello"), "hello")
+			mustOpen(t, alice, mustSeal(t, bob, "hi"), "hi")
+		}
+
+		payload := mustSeal(t, alice, "hello")
+		payload[len(payload)-1] ^= 0x01
+		if _, err := bob.Open(payload); err == nil {
+			t.Fatalf("%v: a tampered message is accepted", c)
+		}
+
+		alice.Destroy()
+		bob.Destroy()
+	}
+}
+
+func TestSuitesDefault(t *testing.T) {
+	alice, bob := newPair(t)
+	defer alice.Destroy()
+	defer bob.Destroy()
+
+	if alice.Suite() != Secretbox || bob.Suite() != Secretbox {
+		t.Fatalf("got %v and %v", alice.Suite(), bob.Suite())
+	}
+}
+
+func TestSuitesNoneInCommon(t *testing.T) {
+	alice, _ := NewSession()
+	bob, _ := NewSession()
+	defer alice.Destroy()
+	defer bob.Destroy()
+
+	alice.SetSuites([]Suite{AES256GCM})
+	bob.SetSuites([]Suite{XChaCha20Poly1305})
+	if err := computePair(alice, bob); err == nil {
+		t.Fatal("computed with no suite in common")
+	}
+}
+
+// A man in the middle who takes the strong suites off Bob's hello ends up
+// with mismatched keys.
+func TestSuitesDowngrade(t *testing.T) {
+	alice, _ := NewSession()
+	bob, _ := NewSession()
+	defer alice.Destroy()
+	defer bob.Destroy()
+
+	alice.SetSuites(AllSuites())
+	bob.SetSuites(AllSuites())
+	if err := alice.Compute(&Hello{Pub: bob.PublicKey(), Suites: []Suite{Secretbox}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := bob.Compute(&Hello{Pub: alice.PublicKey(), Suites: AllSuites()}); err != nil {
+		t.Fatal(err)
+	}
+
+	tag, _ := alice.Confirmation()
+	if err := bob.VerifyConfirmation(tag); err == nil {
+		t.Fatal("keys match after a downgrade")
+	}
+}
+
+func TestSetSuites(t *testing.T) {
+	s, _ := NewSession()
+	defer s.Destroy()
+
+	if err := s.SetSuites(nil); err == nil {
+		t.Fatal("no suite is accepted")
+	}
+	if err := s.SetSuites([]Suite{XChaCha20Poly1305 + 1}); err == nil {
+		t.Fatal("an unknown suite is accepted")
+	}
+
+	alice, bob := newPair(t)
+	defer alice.Destroy()
+	defer bob.Destroy()
+	if err := alice.SetSuites(AllSuites()); err == nil {
+		t.Fatal("suites are changed after the key exchange")
+	}
+}
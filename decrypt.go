@@ -2,11 +2,20 @@ package main
 
 import (
 	"errors"
+	"time"
+
+	"github.com/awnumar/memguard"
 
 	"ekyu.moe/soda/codec"
+	"ekyu.moe/soda/convey"
+	"ekyu.moe/soda/core"
+	"ekyu.moe/soda/identity"
 	"ekyu.moe/soda/packager"
 )
 
+// How long a message that burns after reading stays on the screen.
+const burnCountdown = 30 * time.Second
+
 func decrypt() error {
 	// Prompt input method
 	informln("For the encrypted text:")
@@ -22,18 +31,16 @@ func decrypt() error {
 		return err
 	}
 
-	// Read payload
-	payloadStr, err := read()
+	// Read payload, which may come in parts
+	payloadStr, err := readParts(read)
 	if err != nil {
 		return err
 	}
 
 	// Decode payload
-	payload := codec.DetectCodecAndDecode(string(payloadStr))
-
-	// Validate length (4 crc32 + 24 nonce)
-	if len(payload) <= 28 {
-		return errors.New("wrong payload size")
+	payload, err := codec.Decode(payloadStr)
+	if err != nil {
+		return err
 	}
 
 	// Check and detach crc32
@@ -42,19 +49,115 @@ func decrypt() error {
 		return errors.New("crc32 checksum failed")
 	}
 
-	// Open it
-	packet, err := session.Open(encrypted)
-	if err != nil {
+	// Open it, with the group it is sealed for if it is a group message
+	var sender string
+	c := groupOf(encrypted)
+	var packet *memguard.LockedBuffer
+	if c != nil {
+		sender, packet, err = c.group.Open(encrypted)
+	} else {
+		packet, err = session.Open(encrypted)
+	}
+	switch err {
+	case nil:
+	case core.ErrRekeyRequest:
+		return ackRekey()
+	case core.ErrRekeyAck:
+		informln("Your partner has replied, the session key is refreshed from your next message on.")
+		return nil
+	default:
 		return err
 	}
 	defer packet.Destroy()
 
 	// Unpack packet
-	plain, err := packager.Unpack(packet)
+	plain, header, meta, err := packager.Unpack(packet)
 	if err != nil {
 		return err
 	}
 	defer plain.Destroy()
 
-	return write(plain.Buffer())
+	// Check the meta before anything is shown
+	if meta.Expired() {
+		return errors.New("the message has expired at " + meta.Expiry.Format(time.RFC1123))
+	}
+
+	// A sender key is only taken from the partner it comes from.
+	if header.Content == packager.ContentSenderKey {
+		if c != nil {
+			return errors.New("a sender key must not be sent to a group")
+		}
+		return receiveSenderKey(plain)
+	}
+
+	if c != nil {
+		informf("This message is from %s in %s.\n", sender, c.name)
+	}
+	if header.Content != packager.ContentText {
+		informln("This message is binary data, rather than text.")
+	}
+
+	if meta.Signature != nil {
+		if !identity.VerifyMessage(meta.Signer, plain.Buffer(), meta.Signature) {
+			return errors.New("the signature of the message is invalid")
+		}
+		informf("This message is signed by %s.\n", describeSigner(meta.Signer))
+	}
+	if !meta.Expiry.IsZero() {
+		informf("This message expires at %s.\n", meta.Expiry.Format(time.RFC1123))
+	}
+	if meta.Burn {
+		informf("This message burns after reading, it is erased in %d seconds.\n", burnCountdown/time.Second)
+		write = convey.TerminalBurn(burnCountdown)
+	}
+
+	if err := write(plain.Buffer()); err != nil {
+		return err
+	}
+
+	// A message that burns after reading is not to be kept.
+	if meta.Signature == nil || meta.Burn {
+		return nil
+	}
+
+	export, err := promptExportSigned()
+	if err != nil || !export {
+		return err
+	}
+
+	return exportSigned(meta.Signer, plain.Buffer(), meta.Signature)
+}
+
+// readParts reads the encrypted text with read. If it is split into parts,
+// it keeps asking for the rest until all of them are there, in any order.
+func readParts(read convey.ReadFunc) (string, error) {
+	chunks := new(codec.Chunks)
+	for {
+		text, err := read()
+		if err != nil {
+			return "", err
+		}
+
+		found, err := chunks.Add(string(text))
+		if err != nil {
+			return "", err
+		}
+		if !found {
+			if have, _ := chunks.Count(); have == 0 {
+				// Not split at all
+				return string(text), nil
+			}
+			informln("No part is found in it.")
+		}
+
+		have, total := chunks.Count()
+		if have == total {
+			return chunks.Join()
+		}
+
+		informf("Got %d of %d parts. For the rest:\n", have, total)
+		if read, err = promptInputReader(); err != nil {
+			return "", err
+		}
+	}
 }
@@ -2,13 +2,28 @@ package main
 
 import (
 	"errors"
+	"strings"
+	"time"
 
 	"github.com/awnumar/memguard"
 
+	"ekyu.moe/soda/codec"
+	"ekyu.moe/soda/core"
 	"ekyu.moe/soda/packager"
 )
 
 func encrypt() error {
+	// Don't bother prompting for anything that can't be sealed
+	if session.AwaitingPartner() {
+		return core.ErrAwaitingPartner
+	}
+
+	return encryptWith(session.Seal)
+}
+
+// encryptWith encrypts the plain text read from the user with seal, which
+// destroys the packet.
+func encryptWith(seal func(*memguard.LockedBuffer) ([]byte, error)) error {
 	// Prompt input method
 	informln("For the plain text:")
 	read, err := promptInputReader()
@@ -16,12 +31,49 @@ func encrypt() error {
 		return err
 	}
 
-	// Prompt output codec
+	// Prompt expiry and burning
+	meta := new(packager.Meta)
+	expiry, err := promptExpiry()
+	if err != nil {
+		return err
+	}
+	if expiry > 0 {
+		meta.Expiry = time.Now().Add(expiry)
+	}
+	if meta.Burn, err = promptBurn(); err != nil {
+		return err
+	}
+
+	// Prompt padding
+	padding, err := promptPadding()
+	if err != nil {
+		return err
+	}
+
+	// Prompt signing, which needs an identity
+	sign := false
+	if keyring != nil {
+		if sign, err = promptSign(); err != nil {
+			return err
+		}
+	}
+
+	// Prompt output codec, armor can't be split
 	informln("For the encrypted text:")
-	encode, err := promptOutputCodec()
+	budget, err := promptChunkBudget()
 	if err != nil {
 		return err
 	}
+	var encode codec.EncodeFunc
+	if budget > 0 {
+		c, err := promptCodec()
+		if err != nil {
+			return err
+		}
+		encode = c.Encode
+	} else if encode, err = promptOutputCodec(); err != nil {
+		return err
+	}
 
 	// Prompt output method
 	write, err := promptOutputWriter()
@@ -40,16 +92,22 @@ func encrypt() error {
 		return errors.New("plain text cannot be empty")
 	}
 
+	// Sign the plain text itself, so that the signature can be verified
+	// without the session
+	if sign {
+		meta.Signer = keyring.PublicKey()
+		meta.Signature = keyring.Sign(raw)
+	}
+
 	plain, err := memguard.NewImmutableFromBytes(raw)
 	if err != nil {
 		return err
 	}
 	defer plain.Destroy()
 
-	// Pack it
-	// It will try to compress the plain text
-	// and the packet will be destroyed after packing
-	packet, err := packager.Pack(plain)
+	// Pack it along with the meta
+	// It will try to compress the plain text, then pad it
+	packet, err := packager.Pack(plain, padding, packager.ContentText, meta)
 	if err != nil {
 		return err
 	}
@@ -57,7 +115,7 @@ func encrypt() error {
 
 	// Seal
 	// The packet will be destroyed after sealing
-	encrypted, err := session.Seal(packet)
+	encrypted, err := seal(packet)
 	if err != nil {
 		return err
 	}
@@ -68,6 +126,18 @@ func encrypt() error {
 	// Encode the packet
 	payloadStr := encode(payload)
 
+	// Split it if asked to
+	if budget > 0 {
+		parts, err := codec.Split(payloadStr, budget)
+		if err != nil {
+			return err
+		}
+		if len(parts) > 1 {
+			informf("The encrypted text is split into %d parts, send them all.\n", len(parts))
+		}
+		payloadStr = strings.Join(parts, "\n\n")
+	}
+
 	// Output the payload
 	return write([]byte(payloadStr))
 }
@@ -0,0 +1,239 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/awnumar/memguard"
+
+	"ekyu.moe/soda/core"
+	"ekyu.moe/soda/packager"
+)
+
+// groupChat is a group we are in. Its members are partners, named the same as
+// them, as their sender keys can only come from their pairwise sessions.
+type groupChat struct {
+	name  string
+	group *core.Group
+}
+
+var groups []*groupChat
+
+func groupMenu() error {
+	cmd, err := promptGroupCmd()
+	if err != nil {
+		return err
+	}
+
+	if cmd == GROUP_CREATE {
+		return createGroup()
+	}
+
+	c, err := promptGroup()
+	if err != nil {
+		return err
+	}
+
+	switch cmd {
+	case GROUP_SEND:
+		return encryptWith(c.group.Seal)
+	case GROUP_SHARE:
+		return shareSenderKey(c)
+	case GROUP_REMOVE:
+		return removeGroupMember(c)
+	case GROUP_LEAVE:
+		return leaveGroup(c)
+	}
+
+	return nil
+}
+
+func createGroup() error {
+	name, err := promptGroupName(fmt.Sprintf("Group %d", len(groups)+1))
+	if err != nil {
+		return err
+	}
+
+	g, err := core.NewGroup()
+	if err != nil {
+		return err
+	}
+	c := &groupChat{name: name, group: g}
+	groups = append(groups, c)
+
+	informf("The group %s is created. Send your sender key to whoever you want in it.\n", name)
+
+	return shareSenderKey(c)
+}
+
+// shareSenderKey sends our sender key to the partners chosen.
+func shareSenderKey(c *groupChat) error {
+	recipients, err := promptRecipients()
+	if err != nil {
+		return err
+	}
+
+	for _, p := range recipients {
+		if err := sendSenderKey(c, p); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// sendSenderKey seals our sender key with the session of p.
+func sendSenderKey(c *groupChat, p *partner) error {
+	informf("For the sender key of %s to %s:\n", c.name, p.name)
+	encode, err := promptOutputCodec()
+	if err != nil {
+		return err
+	}
+	write, err := promptKeyOutputWriter()
+	if err != nil {
+		return err
+	}
+
+	key, err := c.group.SenderKey()
+	if err != nil {
+		return err
+	}
+	defer key.Destroy()
+
+	packet, err := packager.Pack(key, packager.DefaultPadding, packager.ContentSenderKey, nil)
+	if err != nil {
+		return err
+	}
+	defer packet.Destroy()
+
+	encrypted, err := p.session.Seal(packet)
+	if err != nil {
+		return err
+	}
+
+	return write([]byte(encode(packager.AttachCrc32(encrypted))))
+}
+
+// receiveSenderKey adds the sender key of the current partner, joining the
+// group first if it is new to us.
+func receiveSenderKey(key *memguard.LockedBuffer) error {
+	p := currentPartner()
+	if p == nil {
+		return errors.New("no partner to take the sender key from")
+	}
+
+	id, err := core.SenderKeyGroup(key)
+	if err != nil {
+		return err
+	}
+
+	c := findGroup(id)
+	if c == nil {
+		informf("%s invites you to a group.\n", p.name)
+		join, err := promptJoinGroup()
+		if err != nil || !join {
+			return err
+		}
+
+		name, err := promptGroupName(fmt.Sprintf("Group %d", len(groups)+1))
+		if err != nil {
+			return err
+		}
+		g, err := core.JoinGroup(id)
+		if err != nil {
+			return err
+		}
+		c = &groupChat{name: name, group: g}
+		groups = append(groups, c)
+	}
+
+	wasMember := c.hasMember(p.name)
+	if err := c.group.AddMember(p.name, key); err != nil {
+		return err
+	}
+
+	informf("The sender key of %s in %s is added, the members are now %s.\n", p.name, c.name, strings.Join(c.group.Members(), ", "))
+	informln("Compare it with everyone in the group:")
+	printAuthString(c.group.AuthString())
+
+	if wasMember {
+		return nil
+	}
+
+	informf("%s needs your sender key as well.\n", p.name)
+	return sendSenderKey(c, p)
+}
+
+// removeGroupMember removes a member, and sends our new sender key to the
+// members left, as the one removed still knows the old one.
+func removeGroupMember(c *groupChat) error {
+	name, err := promptGroupMember(c)
+	if err != nil {
+		return err
+	}
+
+	if err := c.group.RemoveMember(name); err != nil {
+		return err
+	}
+
+	informf("%s is removed from %s. The others need your new sender key, and should remove %s too.\n", name, c.name, name)
+	for _, member := range c.group.Members() {
+		p := findPartner(member)
+		if p == nil {
+			continue
+		}
+		if err := sendSenderKey(c, p); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func leaveGroup(c *groupChat) error {
+	c.group.Destroy()
+	for i, v := range groups {
+		if v == c {
+			groups = append(groups[:i], groups[i+1:]...)
+			break
+		}
+	}
+
+	informf("You have left %s. Ask the others to remove you from it.\n", c.name)
+
+	return nil
+}
+
+func findGroup(id *[16]byte) *groupChat {
+	for _, c := range groups {
+		if *c.group.ID() == *id {
+			return c
+		}
+	}
+
+	return nil
+}
+
+// groupOf returns the group a payload is sealed for, if any. A group message
+// begins with the group ID.
+func groupOf(payload []byte) *groupChat {
+	for _, c := range groups {
+		if bytes.HasPrefix(payload, c.group.ID()[:]) {
+			return c
+		}
+	}
+
+	return nil
+}
+
+func (c *groupChat) hasMember(name string) bool {
+	for _, m := range c.group.Members() {
+		if m == name {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,393 @@
+package main
+
+import (
+	"crypto/mlkem"
+	"errors"
+
+	"ekyu.moe/soda/codec"
+	"ekyu.moe/soda/convey"
+	"ekyu.moe/soda/core"
+	"ekyu.moe/soda/i18n"
+	"ekyu.moe/soda/packager"
+)
+
+// handshake generates the session and exchanges keys with the partner. Errors
+// about the partner's key are printed and the key is asked again, only fatal
+// ones are returned.
+func handshake(kex int) error {
+	// Refuse before the partner is bothered
+	if kex == KEX_NOISE {
+		if err := checkNoiseRekeyPolicy(); err != nil {
+			return err
+		}
+	}
+
+	informln("\nYour key pair is to be generated.")
+
+	// Prompt output codec
+	informln("For your own public key:")
+	encode, err := promptOutputCodec()
+	if err != nil {
+		return err
+	}
+
+	// Prompt output method, a QR code is handy between a phone and a computer
+	write, err := promptKeyOutputWriter()
+	if err != nil {
+		return err
+	}
+
+	// A Noise handshake is a protocol of its own
+	if kex == KEX_NOISE {
+		return noiseHandshake(encode, write)
+	}
+
+	// Prompt hybrid key exchange
+	hybrid, err := promptHybrid()
+	if err != nil {
+		return err
+	}
+
+	// Prompt cipher suites
+	suites, err := promptSuites()
+	if err != nil {
+		return err
+	}
+
+	// Generate session (key pair)
+	session, err = core.NewSession()
+	if err != nil {
+		return err
+	}
+	if err := session.SetSuites(suites); err != nil {
+		return err
+	}
+
+	hello := &core.Hello{
+		Pub:    session.PublicKey(),
+		Suites: session.Suites(),
+	}
+
+	// Derive the PAKE element from the passphrase
+	if kex == KEX_PAKE {
+		passphrase, err := promptSharedPassphrase()
+		if err != nil {
+			return err
+		}
+
+		hello.PAKE, err = session.StartPAKE(passphrase.Buffer())
+		passphrase.Destroy()
+		if err != nil {
+			return err
+		}
+	}
+
+	// Generate the ML-KEM key pair
+	if hybrid {
+		hello.KEM, err = session.StartKEM()
+		if err != nil {
+			return err
+		}
+	}
+
+	// Bind the public key to our identity, if any
+	bindHello(hello)
+
+	myHello := hello.Marshal()
+
+	// Commit to our public key before seeing the partner's, so that nobody in
+	// the middle can pick his keys to match the short authentication string.
+	// It is not shown with a passphrase.
+	var hisCommitment []byte
+	if kex != KEX_PAKE {
+		if hisCommitment, err = exchangeCommitment(encode, write, myHello); err != nil {
+			return err
+		}
+	}
+
+	// Append crc32 to the head
+	packet := packager.AttachCrc32(myHello)
+
+	// Encode public key
+	myPubStr := encode(packet)
+
+	// Output public key
+	informln("\nYour public key for the partner:")
+	if err := write([]byte(myPubStr)); err != nil {
+		return err
+	}
+
+	for {
+		// Read partner's public key
+		raw, err := readPacket("public key", 32)
+		if err != nil {
+			return err
+		}
+
+		if hisCommitment != nil && !core.CheckCommitment(hisCommitment, raw) {
+			perror(errors.New("partner's public key does not match the commitment"))
+			continue
+		}
+
+		hisHello, err := core.ParseHello(raw)
+		if err != nil {
+			perror(err)
+			continue
+		}
+
+		// Check partner's identity
+		if err := checkIdentity(hisHello); err != nil {
+			perror(err)
+			continue
+		}
+
+		if kex == KEX_PAKE && hisHello.PAKE == nil {
+			perror(errors.New("your partner is not using a passphrase"))
+			continue
+		}
+
+		// Compute shared secret. In a hybrid key exchange, encapsulate to the
+		// partner first and compute after the second leg.
+		var ciphertext []byte
+		switch {
+		case hybrid:
+			ciphertext, err = session.Encapsulate(hisHello)
+		case kex == KEX_PAKE:
+			err = session.ComputePAKE(hisHello)
+		default:
+			err = session.Compute(hisHello)
+		}
+		if err != nil {
+			perror(err)
+			continue
+		}
+
+		if hybrid {
+			if err := exchangeCiphertext(encode, write, ciphertext, kex, hisHello); err != nil {
+				session.Destroy()
+				return err
+			}
+		}
+
+		break
+	}
+
+	informf("Cipher suite: %s\n", session.Suite())
+
+	// Make sure both sides have computed the same key
+	if err := confirmKey(encode, write); err != nil {
+		session.Destroy()
+		return err
+	}
+
+	// Verify the short authentication string over another channel. This is
+	// not needed with a passphrase, which already keeps out anyone in the
+	// middle.
+	if kex != KEX_PAKE {
+		return verifyAuthString()
+	}
+
+	return nil
+}
+
+// noiseHandshake runs the Noise handshake with the partner, who may use any
+// Noise implementation, see core.Session.StartNoise. The handshake messages
+// are carried like public keys, with a crc32.
+func noiseHandshake(encode codec.EncodeFunc, write convey.WriteFunc) error {
+	initiator, err := promptNoiseInitiator()
+	if err != nil {
+		return err
+	}
+
+	session, err = core.NewSession()
+	if err != nil {
+		return err
+	}
+	if err := session.StartNoise(initiator); err != nil {
+		session.Destroy()
+		return err
+	}
+
+	// Nothing else is exchanged, identities included.
+	if keyring != nil {
+		hintf("    Identity keys are not exchanged in a Noise handshake, your partner is only verified by voice.\n")
+	}
+
+	writeMessage := func() error {
+		msg, err := session.WriteNoiseMessage()
+		if err != nil {
+			return err
+		}
+
+		informln("\nYour Noise message for the partner:")
+		return write([]byte(encode(packager.AttachCrc32(msg))))
+	}
+	readMessage := func(minLen int) error {
+		for {
+			raw, err := readPacket("Noise message", minLen)
+			if err != nil {
+				return err
+			}
+
+			if err := session.ReadNoiseMessage(raw); err != nil {
+				perror(err)
+				continue
+			}
+
+			return nil
+		}
+	}
+
+	// -> e
+	// <- e, ee
+	if initiator {
+		err = writeMessage()
+		if err == nil {
+			err = readMessage(32 + 16)
+		}
+	} else {
+		err = readMessage(32)
+		if err == nil {
+			err = writeMessage()
+		}
+	}
+	if err != nil {
+		session.Destroy()
+		return err
+	}
+
+	informf("Protocol: %s\n", core.NoiseProtocol)
+
+	return verifyAuthString()
+}
+
+// verifyAuthString has the short authentication string verified over another
+// channel. The session is destroyed if it is not.
+func verifyAuthString() error {
+	informf("\n%s\n", i18n.AUTH_STRING)
+	printAuthString(session.AuthString())
+	confirmed, err := promptConfirmAuthString()
+	if err != nil {
+		session.Destroy()
+		return err
+	}
+	if !confirmed {
+		session.Destroy()
+		return errors.New(i18n.AUTH_STRING_MISMATCH)
+	}
+
+	return nil
+}
+
+// exchangeCommitment sends our commitment to hello, then reads the partner's.
+func exchangeCommitment(encode codec.EncodeFunc, write convey.WriteFunc, hello []byte) ([]byte, error) {
+	informln("\nYour commitment for the partner, send your public key only after you have theirs:")
+	packet := packager.AttachCrc32(core.Commit(hello))
+	if err := write([]byte(encode(packet))); err != nil {
+		return nil, err
+	}
+
+	return readPacket("commitment", core.CommitmentSize)
+}
+
+// exchangeCiphertext is the second leg of a hybrid key exchange: send our
+// ML-KEM ciphertext, read the partner's, then compute the shared secret.
+func exchangeCiphertext(encode codec.EncodeFunc, write convey.WriteFunc, ciphertext []byte, kex int, hisHello *core.Hello) error {
+	informln("\nYour ciphertext for the partner:")
+	packet := packager.AttachCrc32(ciphertext)
+	if err := write([]byte(encode(packet))); err != nil {
+		return err
+	}
+
+	for {
+		// Read partner's ciphertext
+		raw, err := readPacket("ciphertext", mlkem.CiphertextSize768)
+		if err != nil {
+			return err
+		}
+
+		if err := session.Decapsulate(raw); err != nil {
+			perror(err)
+			continue
+		}
+
+		break
+	}
+
+	// Nothing can be asked again from here on, so errors are fatal.
+	if kex == KEX_PAKE {
+		return session.ComputePAKE(hisHello)
+	}
+
+	return session.Compute(hisHello)
+}
+
+// confirmKey exchanges key confirmation tags with the partner, so that a key
+// pasted wrong is caught before the session begins, rather than when the first
+// message fails to open.
+func confirmKey(encode codec.EncodeFunc, write convey.WriteFunc) error {
+	tag, err := session.Confirmation()
+	if err != nil {
+		return err
+	}
+
+	informln("\nYour key confirmation for the partner:")
+	packet := packager.AttachCrc32(tag)
+	if err := write([]byte(encode(packet))); err != nil {
+		return err
+	}
+
+	// Read partner's key confirmation
+	raw, err := readPacket("key confirmation", core.ConfirmationSize)
+	if err != nil {
+		return err
+	}
+
+	if err := session.VerifyConfirmation(raw); err != nil {
+		return errors.New(err.Error() + ", please start over and check the public keys")
+	}
+
+	return nil
+}
+
+// readPacket reads a packet from the partner until it has at least minLen
+// bytes and passes the crc32 check. Only fatal errors are returned.
+func readPacket(name string, minLen int) ([]byte, error) {
+	for {
+		// Prompt input method
+		informf("\nFor your partner's %s:\n", name)
+		read, err := promptKeyInputReader()
+		if err != nil {
+			// this one is fatal
+			return nil, err
+		}
+
+		text, err := read()
+		if err != nil {
+			perror(err)
+			continue
+		}
+
+		// Decode packet
+		packet, err := codec.Decode(string(text))
+		if err != nil {
+			perror(err)
+			continue
+		}
+
+		// Validate length (4 crc32 + minLen)
+		if len(packet) < 4+minLen {
+			perror(errors.New("wrong " + name + " size"))
+			continue
+		}
+
+		// Check crc32
+		raw, ok := packager.DetachCrc32(packet)
+		if !ok {
+			perror(errors.New("crc32 checksum failed"))
+			continue
+		}
+
+		return raw, nil
+	}
+}
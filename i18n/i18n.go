@@ -18,8 +18,14 @@ var (
 	PROMPT_CMD_HELP,
 	PROMPT_CMD_ENC,
 	PROMPT_CMD_DEC,
+	PROMPT_CMD_BROADCAST,
+	PROMPT_CMD_ADD_PARTNER,
+	PROMPT_CMD_SWITCH_PARTNER,
+	PROMPT_CMD_GROUP,
+	PROMPT_CMD_VERIFY,
 	PROMPT_CMD_RAND,
 	PROMPT_CMD_CLS,
+	PROMPT_CMD_SAVE,
 	PROMPT_CMD_EXIT,
 	PROMPT_PLAIN,
 	PROMPT_ENCRYPTED,
@@ -30,7 +36,13 @@ var (
 	PROMPT_OUTPUT_TERMINAL,
 	PROMPT_OUTPUT_EDITOR,
 
+	AUTH_STRING,
+	CONFIRM_AUTH_STRING,
+	CONFIRM_AUTH_STRING_HELP,
+	AUTH_STRING_MISMATCH,
+
 	SESSION_BEGIN,
+	MESSAGE_MISSING,
 	ENCRYPTED_BELOW,
 	DECRYPT_FAIL,
 	PLAIN_BELOW,
@@ -66,8 +78,14 @@ files, you'd better use some other tools (such as WinRAR), and encrypt the
 key via this program before sending to your partner.`
 		PROMPT_CMD_ENC = "Encrypt"
 		PROMPT_CMD_DEC = "Decrypt"
+		PROMPT_CMD_BROADCAST = "Encrypt for several partners"
+		PROMPT_CMD_ADD_PARTNER = "Add a partner"
+		PROMPT_CMD_SWITCH_PARTNER = "Switch partner"
+		PROMPT_CMD_GROUP = "Groups"
+		PROMPT_CMD_VERIFY = "Verify a signed message"
 		PROMPT_CMD_CLS = "Clear the screen"
 		PROMPT_CMD_RAND = "Generate a UUIDv4"
+		PROMPT_CMD_SAVE = "Save the session and exit"
 		PROMPT_CMD_EXIT = "Exit"
 		PROMPT_PLAIN = "Press Enter to launch editor, input plain text, save and quit"
 		PROMPT_ENCRYPTED = "Press Enter to launch editor, input encrypted text, save and quit"
@@ -78,7 +96,14 @@ will be destroyed after closing the editor, while printing to terminal is very
 likely to retain a history. That's why editor is preferred.`
 		PROMPT_OUTPUT_TERMINAL = "Terminal"
 		PROMPT_OUTPUT_EDITOR = "Editor"
+		AUTH_STRING = "Short authentication string of this session:"
+		CONFIRM_AUTH_STRING = "Have you and your partner read it to each other, and does it match?"
+		CONFIRM_AUTH_STRING_HELP = `Call your partner and read the emoji or the digits to each other. If anyone
+is in the middle of your key exchange, the strings on both sides will differ.
+Do not compare them over the same channel you used to send the public keys.`
+		AUTH_STRING_MISMATCH = "Authentication string not confirmed, the session has been destroyed."
 		SESSION_BEGIN = "Session Begin"
+		MESSAGE_MISSING = "message #%d from partner was never decrypted"
 		ENCRYPTED_BELOW = "The encrypted text is as follows. You can copy and send it to your partner."
 		DECRYPT_FAIL = "Failed to decrypt. The encrypted text may have been compromised."
 		PLAIN_BELOW = "The plain text is as follows."
@@ -101,8 +126,14 @@ likely to retain a history. That's why editor is preferred.`
 		PROMPT_CMD_HELP = "暗号化と復号化は文字列に対します。ファイルを暗号化の場合、他のツール(WinRAR\nとか)を使って、鍵をここに暗号化して相手に送信してください。"
 		PROMPT_CMD_ENC = "暗号化"
 		PROMPT_CMD_DEC = "復号化"
+		PROMPT_CMD_BROADCAST = "複数の相手に暗号化"
+		PROMPT_CMD_ADD_PARTNER = "相手を追加"
+		PROMPT_CMD_SWITCH_PARTNER = "相手を切り替え"
+		PROMPT_CMD_GROUP = "グループ"
+		PROMPT_CMD_VERIFY = "署名付きメッセージを検証"
 		PROMPT_CMD_CLS = "ターミナルをクリア"
 		PROMPT_CMD_RAND = "UUIDv4 を生成"
+		PROMPT_CMD_SAVE = "セッションを保存して終了"
 		PROMPT_CMD_EXIT = "終了"
 		PROMPT_PLAIN = "Enter キーを押してエディタを開いて、プレーンテキストを入力して、セーブして\nエディタを終了してください"
 		PROMPT_ENCRYPTED = "Enter キーを押してエディタを開いて、暗号化された テキストを入力して、セーブして\nエディタを終了してください"
@@ -111,7 +142,12 @@ likely to retain a history. That's why editor is preferred.`
 		PROMPT_OUTPUT_HELP = "エディタを選択した場合、一時ファイルが作成されて、エディタが終了する時に削除\nされます。ターミナルを選択した場合、履歴ログの保持の可能性は高いです。"
 		PROMPT_OUTPUT_TERMINAL = "ターミナル"
 		PROMPT_OUTPUT_EDITOR = "エディタ"
+		AUTH_STRING = "このセッションの短い認証文字列："
+		CONFIRM_AUTH_STRING = "相手と読み合わせて、一致していますか？"
+		CONFIRM_AUTH_STRING_HELP = "相手に電話をかけて、絵文字または数字を読み合わせてください。鍵交換に中間者が\nいる場合、両方の文字列は異なります。公開鍵を送信したチャネルで比較しないでください。"
+		AUTH_STRING_MISMATCH = "認証文字列は確認されませんでした。セッションは破棄されました。"
 		SESSION_BEGIN = "セッション開始"
+		MESSAGE_MISSING = "相手のメッセージ #%d はまだ復号化されていません"
 		ENCRYPTED_BELOW = "暗号化されたテキストは以下の通りです"
 		DECRYPT_FAIL = "復号化失敗しました、テキストは危殆化されたの可能性は高いです。"
 		PLAIN_BELOW = "復号化されたテキストは以下の通りです"
@@ -133,8 +169,14 @@ likely to retain a history. That's why editor is preferred.`
 		PROMPT_CMD_HELP = "加密與解密針對的都是文字，如果要加密檔案，可以採取別的對稱加密手段\n（如使用 WinRAR 加密），然後再將金鑰通過這裡加密後發給對方。"
 		PROMPT_CMD_ENC = "加密"
 		PROMPT_CMD_DEC = "解密"
+		PROMPT_CMD_BROADCAST = "為多位對象加密"
+		PROMPT_CMD_ADD_PARTNER = "新增對象"
+		PROMPT_CMD_SWITCH_PARTNER = "切換對象"
+		PROMPT_CMD_GROUP = "群組"
+		PROMPT_CMD_VERIFY = "驗證簽名訊息"
 		PROMPT_CMD_CLS = "清屏"
 		PROMPT_CMD_RAND = "生成一段 UUIDv4"
+		PROMPT_CMD_SAVE = "儲存對談並退出"
 		PROMPT_CMD_EXIT = "退出"
 		PROMPT_PLAIN = "按回車鍵打開編輯器，輸入明文，然後保存並關閉編輯器"
 		PROMPT_ENCRYPTED = "按回車鍵打開編輯器，輸入密文，然後保存並關閉編輯器"
@@ -143,7 +185,12 @@ likely to retain a history. That's why editor is preferred.`
 		PROMPT_OUTPUT_HELP = "如選擇編輯器，則會創建一個暫存檔案來存放內容，在關閉編輯器後會被自動删除，\n而输出到終端的話很可能會留下歷史。所以推薦以編輯器的方式查看。"
 		PROMPT_OUTPUT_TERMINAL = "終端"
 		PROMPT_OUTPUT_EDITOR = "編輯器"
+		AUTH_STRING = "本次對談的短認證字串："
+		CONFIRM_AUTH_STRING = "你和對方互相念過了嗎？兩邊是否一致？"
+		CONFIRM_AUTH_STRING_HELP = "請打電話給對方，互相念出表情符號或數字。如果金鑰交換被中間人攻擊，兩邊的字串\n將會不同。請不要通過發送公鑰的管道進行比對。"
+		AUTH_STRING_MISMATCH = "認證字串未被確認，對談已被銷毀。"
 		SESSION_BEGIN = "對談開始"
+		MESSAGE_MISSING = "對方的第 #%d 條訊息從未被解密"
 		ENCRYPTED_BELOW = "以下為剛剛加密的密文，可以複製下來發送給對方了。"
 		DECRYPT_FAIL = "解密失敗。密文很可能已被污染。"
 		PLAIN_BELOW = "以下為剛剛解密的明文"
@@ -165,8 +212,14 @@ likely to retain a history. That's why editor is preferred.`
 		PROMPT_CMD_HELP = "加密与解密针对的都是文本，如果要加密文件，可以采取别的对称加密手段（如使用\nWinRAR 加密），然后再将密钥通过这里加密后发给对方。"
 		PROMPT_CMD_ENC = "加密"
 		PROMPT_CMD_DEC = "解密"
+		PROMPT_CMD_BROADCAST = "为多位对象加密"
+		PROMPT_CMD_ADD_PARTNER = "添加对象"
+		PROMPT_CMD_SWITCH_PARTNER = "切换对象"
+		PROMPT_CMD_GROUP = "群组"
+		PROMPT_CMD_VERIFY = "验证签名消息"
 		PROMPT_CMD_CLS = "清屏"
 		PROMPT_CMD_RAND = "生成一段 UUIDv4"
+		PROMPT_CMD_SAVE = "保存会话并退出"
 		PROMPT_CMD_EXIT = "退出"
 		PROMPT_PLAIN = "按回车键打开编辑器，输入明文，然后保存并关闭编辑器"
 		PROMPT_ENCRYPTED = "按回车键打开编辑器，输入密文，然后保存并关闭编辑器"
@@ -175,7 +228,12 @@ likely to retain a history. That's why editor is preferred.`
 		PROMPT_OUTPUT_HELP = "如选择编辑器，则会创建一个临时文件来存放内容，在关闭编辑器后会被自动删除，\n而打印到终端的话很可能会留下历史。所以推荐以编辑器的方式查看。"
 		PROMPT_OUTPUT_TERMINAL = "控制台"
 		PROMPT_OUTPUT_EDITOR = "编辑器"
+		AUTH_STRING = "本次会话的短认证字符串："
+		CONFIRM_AUTH_STRING = "你和对方互相念过了吗？两边是否一致？"
+		CONFIRM_AUTH_STRING_HELP = "请打电话给对方，互相念出表情符号或数字。如果密钥交换被中间人攻击，两边的字符串\n将会不同。请不要通过发送公钥的渠道进行比对。"
+		AUTH_STRING_MISMATCH = "认证字符串未被确认，会话已被销毁。"
 		SESSION_BEGIN = "会话开始"
+		MESSAGE_MISSING = "对方的第 #%d 条消息从未被解密"
 		ENCRYPTED_BELOW = "以下为刚刚加密的密文，可以复制下来发送给对方了"
 		DECRYPT_FAIL = "解密失败。密文很可能已被污染。"
 		PLAIN_BELOW = "以下为刚刚解密的明文"
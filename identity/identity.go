@@ -0,0 +1,309 @@
+// Package identity manages the long-term identity key and the contact book,
+// both kept in a passphrase-encrypted keyring on the local disk.
+package identity // import "ekyu.moe/soda/identity"
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/awnumar/memguard"
+
+	"ekyu.moe/soda/vault"
+)
+
+var (
+	keyringMagic = []byte("SODAKR")
+	signedMagic  = []byte("SODASG")
+	bindingInfo  = []byte("soda identity binding")
+	messageInfo  = []byte("soda signed message")
+
+	// ErrBadPassphrase is returned when the keyring cannot be decrypted.
+	ErrBadPassphrase = vault.ErrBadPassphrase
+)
+
+// Keyring holds the identity key pair and the pinned contacts. The private key
+// is locked using memguard.
+type Keyring struct {
+	path string
+
+	pub ed25519.PublicKey
+	pri *memguard.LockedBuffer
+
+	contacts map[string][]byte
+}
+
+// DefaultPath returns where the keyring is stored, which can be overridden
+// with $SODA_KEYRING.
+func DefaultPath() (string, error) {
+	if p := os.Getenv("SODA_KEYRING"); p != "" {
+		return p, nil
+	}
+
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(dir, "soda", "keyring"), nil
+}
+
+// Exists reports whether there is a keyring at path.
+func Exists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// Create generates a new identity key pair and saves it to path, encrypted
+// with passphrase.
+func Create(path string, passphrase []byte) (*Keyring, error) {
+	seed, err := memguard.NewImmutableRandom(ed25519.SeedSize)
+	if err != nil {
+		return nil, err
+	}
+	defer seed.Destroy()
+
+	k, err := fromSeed(seed.Buffer())
+	if err != nil {
+		return nil, err
+	}
+	k.path = path
+	k.contacts = make(map[string][]byte)
+
+	if err := k.Save(passphrase); err != nil {
+		k.Destroy()
+		return nil, err
+	}
+
+	return k, nil
+}
+
+// Open decrypts the keyring at path with passphrase.
+func Open(path string, passphrase []byte) (*Keyring, error) {
+	sealed, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	plain, err := vault.Open(keyringMagic, sealed, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	defer plain.Destroy()
+
+	if plain.Size() < ed25519.SeedSize {
+		return nil, errors.New("keyring: bad format")
+	}
+
+	k, err := fromSeed(plain.Buffer()[:ed25519.SeedSize])
+	if err != nil {
+		return nil, err
+	}
+	k.path = path
+
+	if err := json.Unmarshal(plain.Buffer()[ed25519.SeedSize:], &k.contacts); err != nil {
+		k.Destroy()
+		return nil, errors.New("keyring: bad contact book")
+	}
+	if k.contacts == nil {
+		k.contacts = make(map[string][]byte)
+	}
+
+	return k, nil
+}
+
+// Save encrypts the keyring with passphrase and writes it back to disk.
+func (k *Keyring) Save(passphrase []byte) error {
+	contacts, err := json.Marshal(k.contacts)
+	if err != nil {
+		return err
+	}
+
+	plain, err := memguard.NewMutable(ed25519.SeedSize + len(contacts))
+	if err != nil {
+		return err
+	}
+	defer plain.Destroy()
+	copy(plain.Buffer(), k.seed())
+	copy(plain.Buffer()[ed25519.SeedSize:], contacts)
+
+	sealed, err := vault.Seal(keyringMagic, plain, passphrase)
+	if err != nil {
+		return err
+	}
+
+	return vault.WriteFile(k.path, sealed)
+}
+
+// PublicKey returns the identity public key.
+func (k *Keyring) PublicKey() ed25519.PublicKey {
+	return k.pub
+}
+
+// Bind signs an ephemeral session public key with the identity key.
+func (k *Keyring) Bind(sessionPub []byte) []byte {
+	return k.sign(bindingMessage(sessionPub))
+}
+
+// Sign signs a message with the identity key. Unlike a sealed message, which
+// the partner could have forged as well, a signed one proves to anyone that it
+// comes from us.
+func (k *Keyring) Sign(msg []byte) []byte {
+	return k.sign(signedMessage(msg))
+}
+
+// sign signs with a copy of the private key on the heap, as crypto/ed25519
+// caches the expanded key by its address, which has to be Go memory. The copy
+// is wiped once done.
+func (k *Keyring) sign(msg []byte) []byte {
+	private := append(ed25519.PrivateKey(nil), k.pri.Buffer()...)
+	defer func() {
+		for i := range private {
+			private[i] = 0
+		}
+	}()
+
+	return ed25519.Sign(private, msg)
+}
+
+// Lookup finds the name a identity public key is pinned to.
+func (k *Keyring) Lookup(pub ed25519.PublicKey) (string, bool) {
+	for name, v := range k.contacts {
+		if bytes.Equal(v, pub) {
+			return name, true
+		}
+	}
+
+	return "", false
+}
+
+// Contact returns the identity public key pinned to name.
+func (k *Keyring) Contact(name string) (ed25519.PublicKey, bool) {
+	v, ok := k.contacts[name]
+	return ed25519.PublicKey(v), ok
+}
+
+// Contacts returns the names of the pinned contacts, sorted.
+func (k *Keyring) Contacts() []string {
+	names := make([]string, 0, len(k.contacts))
+	for name := range k.contacts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// Pin pins name to pub, replacing the previous key if any. The change is only
+// kept in memory until Save is called.
+func (k *Keyring) Pin(name string, pub ed25519.PublicKey) {
+	k.contacts[name] = append([]byte(nil), pub...)
+}
+
+// Destroy destroys the private key.
+func (k *Keyring) Destroy() {
+	k.pri.Destroy()
+}
+
+func (k *Keyring) seed() []byte {
+	return k.pri.Buffer()[:ed25519.SeedSize]
+}
+
+// Verify checks that sessionPub is bound to the identity public key pub.
+func Verify(pub ed25519.PublicKey, sessionPub, sig []byte) bool {
+	if len(pub) != ed25519.PublicKeySize {
+		return false
+	}
+
+	return ed25519.Verify(pub, bindingMessage(sessionPub), sig)
+}
+
+// VerifyMessage checks that msg is signed by the identity public key pub.
+func VerifyMessage(pub ed25519.PublicKey, msg, sig []byte) bool {
+	if len(pub) != ed25519.PublicKeySize {
+		return false
+	}
+
+	return ed25519.Verify(pub, signedMessage(msg), sig)
+}
+
+// MarshalSigned encodes a signed message, so that it can be kept and verified
+// later by ParseSigned, by anyone.
+//
+// Format:
+//     "SODASG" + pub[32] + signature[64] + msg
+func MarshalSigned(pub ed25519.PublicKey, msg, sig []byte) []byte {
+	ret := make([]byte, 0, len(signedMagic)+len(pub)+len(sig)+len(msg))
+	ret = append(ret, signedMagic...)
+	ret = append(ret, pub...)
+	ret = append(ret, sig...)
+
+	return append(ret, msg...)
+}
+
+// ParseSigned decodes and verifies a signed message made by MarshalSigned,
+// returning the signer and the message.
+func ParseSigned(b []byte) (ed25519.PublicKey, []byte, error) {
+	n := len(signedMagic)
+	if len(b) < n+ed25519.PublicKeySize+ed25519.SignatureSize || !bytes.Equal(b[:n], signedMagic) {
+		return nil, nil, errors.New("signed: bad format")
+	}
+
+	pub := ed25519.PublicKey(b[n : n+ed25519.PublicKeySize])
+	sig := b[n+ed25519.PublicKeySize : n+ed25519.PublicKeySize+ed25519.SignatureSize]
+	msg := b[n+ed25519.PublicKeySize+ed25519.SignatureSize:]
+	if !VerifyMessage(pub, msg, sig) {
+		return nil, nil, errors.New("signed: bad signature")
+	}
+
+	return pub, msg, nil
+}
+
+// Fingerprint returns a human readable digest of a identity public key, like
+//     3f2a 9c1d 77e0 b5a4 0c6e 1f93 d2a8 6b04
+func Fingerprint(pub ed25519.PublicKey) string {
+	sum := sha256.Sum256(pub)
+	digits := hex.EncodeToString(sum[:16])
+
+	groups := make([]string, 0, 8)
+	for i := 0; i < len(digits); i += 4 {
+		groups = append(groups, digits[i:i+4])
+	}
+
+	return strings.Join(groups, " ")
+}
+
+func fromSeed(seed []byte) (*Keyring, error) {
+	// NewKeyFromSeed has the private key on the heap, it is moved into locked
+	// memory right away.
+	private := ed25519.NewKeyFromSeed(seed)
+	pub := append(ed25519.PublicKey(nil), private[32:]...)
+
+	pri, err := memguard.NewImmutableFromBytes(private)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Keyring{
+		pub: pub,
+		pri: pri,
+	}, nil
+}
+
+func bindingMessage(sessionPub []byte) []byte {
+	msg := append([]byte(nil), bindingInfo...)
+	return append(msg, sessionPub...)
+}
+
+func signedMessage(msg []byte) []byte {
+	ret := append([]byte(nil), messageInfo...)
+	return append(ret, msg...)
+}
@@ -0,0 +1,149 @@
+package identity
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// newKeyring creates a keyring in a temporary directory, which is removed by
+// the returned func.
+func newKeyring(t *testing.T) (*Keyring, func()) {
+	t.Helper()
+
+	dir, err := ioutil.TempDir("", "soda")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	k, err := Create(filepath.Join(dir, "keyring"), []byte("passphrase"))
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+
+	return k, func() {
+		k.Destroy()
+		os.RemoveAll(dir)
+	}
+}
+
+func TestKeyring(t *testing.T) {
+	k, done := newKeyring(t)
+	defer done()
+
+	other, otherDone := newKeyring(t)
+	defer otherDone()
+
+	k.Pin("bob", other.PublicKey())
+	if err := k.Save([]byte("passphrase")); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Open(k.path, []byte("wrong")); err != ErrBadPassphrase {
+		t.Fatalf("got %v, want ErrBadPassphrase", err)
+	}
+
+	opened, err := Open(k.path, []byte("passphrase"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer opened.Destroy()
+
+	if !opened.PublicKey().Equal(k.PublicKey()) {
+		t.Fatal("the identity key changes once saved")
+	}
+	if name, ok := opened.Lookup(other.PublicKey()); !ok || name != "bob" {
+		t.Fatalf("got %q, want bob", name)
+	}
+	if pub, ok := opened.Contact("bob"); !ok || !pub.Equal(other.PublicKey()) {
+		t.Fatal("the pinned key of bob is lost")
+	}
+	if _, ok := opened.Lookup(k.PublicKey()); ok {
+		t.Fatal("an unknown key is found")
+	}
+
+	opened.Pin("alice", k.PublicKey())
+	if got := opened.Contacts(); len(got) != 2 || got[0] != "alice" || got[1] != "bob" {
+		t.Fatalf("got contacts %q", got)
+	}
+}
+
+func TestBind(t *testing.T) {
+	k, done := newKeyring(t)
+	defer done()
+
+	sessionPub := make([]byte, 32)
+	sig := k.Bind(sessionPub)
+	if !Verify(k.PublicKey(), sessionPub, sig) {
+		t.Fatal("a binding does not verify")
+	}
+
+	sessionPub[0] ^= 0x01
+	if Verify(k.PublicKey(), sessionPub, sig) {
+		t.Fatal("a binding verifies for another session key")
+	}
+	if Verify(k.PublicKey()[:31], sessionPub, sig) {
+		t.Fatal("a binding verifies with a truncated key")
+	}
+}
+
+func TestFingerprint(t *testing.T) {
+	k, done := newKeyring(t)
+	defer done()
+
+	fp := Fingerprint(k.PublicKey())
+	if len(fp) != 8*4+7 {
+		t.Fatalf("got %q", fp)
+	}
+	if fp != Fingerprint(k.PublicKey()) {
+		t.Fatal("the fingerprint is not stable")
+	}
+}
+
+func TestSigned(t *testing.T) {
+	k, done := newKeyring(t)
+	defer done()
+
+	msg := []byte("I owe Bob 10 dollars.")
+	sig := k.Sign(msg)
+	if !VerifyMessage(k.PublicKey(), msg, sig) {
+		t.Fatal("a signature does not verify")
+	}
+	if VerifyMessage(k.PublicKey(), []byte("I owe Bob 100 dollars."), sig) {
+		t.Fatal("a signature verifies for another message")
+	}
+
+	// A message signature is not a binding, and the other way around.
+	if Verify(k.PublicKey(), msg, sig) || VerifyMessage(k.PublicKey(), msg, k.Bind(msg)) {
+		t.Fatal("signatures of one kind verify as the other")
+	}
+
+	pub, got, err := ParseSigned(MarshalSigned(k.PublicKey(), msg, sig))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !pub.Equal(k.PublicKey()) || string(got) != string(msg) {
+		t.Fatal("a signed message changes once marshaled")
+	}
+}
+
+func TestParseSignedBad(t *testing.T) {
+	k, done := newKeyring(t)
+	defer done()
+
+	msg := []byte("hello")
+	signed := MarshalSigned(k.PublicKey(), msg, k.Sign(msg))
+
+	for i := range signed {
+		tampered := append([]byte(nil), signed...)
+		tampered[i] ^= 0x01
+		if _, _, err := ParseSigned(tampered); err == nil {
+			t.Fatalf("tampered byte %d is accepted", i)
+		}
+	}
+	if _, _, err := ParseSigned(signed[:len(signedMagic)+32]); err == nil {
+		t.Fatal("a truncated signed message is accepted")
+	}
+}
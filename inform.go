@@ -1,8 +1,12 @@
 package main
 
 import (
+	"bytes"
 	"fmt"
+	"math/big"
+	"strings"
 
+	"ekyu.moe/base256"
 	"github.com/mattn/go-colorable"
 	surveyTerm "gopkg.in/AlecAivazis/survey.v1/terminal"
 
@@ -41,14 +45,86 @@ func hintf(format string, a ...interface{}) {
 	fmt.Fprintf(stdout, format, a...)
 }
 
-// Special case
+// Special case, partner's messages never decrypted are warned next to the ID.
 func printID() {
-	fmt.Fprintf(stdout, "\x1b[1;35m[#%d]\x1b[0m\n", id)
+	if p := currentPartner(); p != nil && len(partners) > 1 {
+		fmt.Fprintf(stdout, "\x1b[1;35m[#%d %s]\x1b[0m", id, p.name)
+	} else {
+		fmt.Fprintf(stdout, "\x1b[1;35m[#%d]\x1b[0m", id)
+	}
+	for _, seq := range session.Missing() {
+		fmt.Fprintf(stdout, "  \x1b[1;33m"+i18n.MESSAGE_MISSING+"\x1b[0m", seq)
+	}
+	fmt.Fprintln(stdout)
+}
+
+// Special case, the short authentication string is printed both in emoji and
+// in digits, so that it can be read aloud either way. Both carry every bit of
+// it, the digits are in groups of three.
+func printAuthString(sas []byte) {
+	emoji := strings.Join(strings.Split(base256.EncodeToString(sas), ""), "  ")
+
+	// As many digits as the largest value takes
+	width := len(new(big.Int).SetBytes(bytes.Repeat([]byte{0xff}, len(sas))).String())
+	digits := new(big.Int).SetBytes(sas).String()
+	digits = strings.Repeat("0", width-len(digits)) + digits
+
+	var groups []string
+	for len(digits) > 3 {
+		groups = append(groups, digits[:3])
+		digits = digits[3:]
+	}
+	groups = append(groups, digits)
+
+	fmt.Fprintf(stdout, "\n    \x1b[1m%s\x1b[0m\n    \x1b[1m%s\x1b[0m\n\n",
+		emoji, strings.Join(groups, " "))
+}
+
+// Special case, it must be loud.
+func warnIdentityChanged(name, old, now string) {
+	warnLoud("THE IDENTITY KEY OF "+strings.ToUpper(name)+" HAS CHANGED!",
+		"Pinned: "+old,
+		"Now:    "+now,
+		"",
+		"Someone may be impersonating "+name+".")
+}
+
+// Special case, it must be loud.
+func warnIdentityUnknown(fingerprint string) {
+	warnLoud("YOUR PARTNER'S IDENTITY KEY IS NOT PINNED!",
+		"Fingerprint: "+fingerprint,
+		"",
+		"If they are one of your contacts, someone may be impersonating them.",
+		"Check the fingerprint with your partner by voice before trusting it.")
+}
+
+// Special case, it must be loud.
+func warnNoIdentity() {
+	warnLoud("YOUR PARTNER HAS NO IDENTITY KEY!",
+		"Their key is not bound to anyone, so there is no telling whether they",
+		"are one of your contacts or someone in the middle who dropped it.",
+		"",
+		"Only go on if your partner has no keyring.")
+}
+
+func warnLoud(title string, lines ...string) {
+	banner := strings.Repeat("!", 72)
+
+	fmt.Fprintf(stdout, "\n\x1b[1;31m%s\n", banner)
+	fmt.Fprintf(stdout, "  WARNING: %s\n\n", title)
+	for _, line := range lines {
+		if line == "" {
+			fmt.Fprintln(stdout)
+		} else {
+			fmt.Fprintf(stdout, "  %s\n", line)
+		}
+	}
+	fmt.Fprintf(stdout, "%s\x1b[0m\n\n", banner)
 }
 
 func perror(err error) {
 	if err == surveyTerm.InterruptErr {
-		fmt.Frintln(stdout)
+		fmt.Fprintln(stdout)
 	} else {
 		fmt.Fprintf(stdout, "\n  \x1b[1;31m%s\x1b[0m\n    \x1b[1;31m%s\x1b[0m\n\n", i18n.EXCEPTION_OCCURRED, err)
 	}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"errors"
+
+	"github.com/awnumar/memguard"
+
+	"ekyu.moe/soda/core"
+	"ekyu.moe/soda/identity"
+)
+
+var (
+	// keyring is nil if the user chose to stay anonymous.
+	keyring           *identity.Keyring
+	keyringPassphrase *memguard.LockedBuffer
+)
+
+// unlockKeyring opens the local keyring, or offers to create one if there is
+// none yet.
+func unlockKeyring() error {
+	path, err := identity.DefaultPath()
+	if err != nil {
+		return err
+	}
+
+	if !identity.Exists(path) {
+		create, err := promptCreateKeyring()
+		if err != nil || !create {
+			return err
+		}
+
+		passphrase, err := promptNewPassphrase()
+		if err != nil {
+			return err
+		}
+
+		kr, err := identity.Create(path, passphrase.Buffer())
+		if err != nil {
+			passphrase.Destroy()
+			return err
+		}
+
+		keyring, keyringPassphrase = kr, passphrase
+		informf("Your identity fingerprint is %s\n", identity.Fingerprint(kr.PublicKey()))
+		return nil
+	}
+
+	for {
+		passphrase, err := promptPassphrase()
+		if err != nil {
+			return err
+		}
+
+		kr, err := identity.Open(path, passphrase.Buffer())
+		if err == identity.ErrBadPassphrase {
+			passphrase.Destroy()
+			perror(err)
+			continue
+		}
+		if err != nil {
+			passphrase.Destroy()
+			return err
+		}
+
+		keyring, keyringPassphrase = kr, passphrase
+		informf("Your identity fingerprint is %s\n", identity.Fingerprint(kr.PublicKey()))
+		return nil
+	}
+}
+
+// bindHello attaches our identity to the hello, if we have one.
+func bindHello(hello *core.Hello) {
+	if keyring == nil {
+		return
+	}
+
+	hello.Identity = keyring.PublicKey()
+	hello.Binding = keyring.Bind(hello.Pub[:])
+}
+
+// checkIdentity verifies the partner's identity against the contact book.
+// Whenever we have a keyring, a partner who is not pinned, or who has no
+// identity at all, is loudly warned about and must be trusted explicitly, as
+// that is just what someone in the middle would look like. A known name showing
+// up with a different key must be trusted again too.
+func checkIdentity(hello *core.Hello) error {
+	if hello.Identity == nil {
+		if keyring == nil {
+			return nil
+		}
+
+		warnNoIdentity()
+		accept, err := promptAcceptNoIdentity()
+		if err != nil {
+			return err
+		}
+		if !accept {
+			return errors.New("partner has no identity key, key rejected")
+		}
+		return nil
+	}
+
+	if !identity.Verify(hello.Identity, hello.Pub[:], hello.Binding) {
+		return errors.New("partner's identity binding is invalid")
+	}
+
+	fingerprint := identity.Fingerprint(hello.Identity)
+	if keyring == nil {
+		informf("\nYour partner's identity fingerprint is %s\n", fingerprint)
+		return nil
+	}
+
+	if name, ok := keyring.Lookup(hello.Identity); ok {
+		informf("\nYour partner is %s (%s)\n", name, fingerprint)
+		return nil
+	}
+
+	warnIdentityUnknown(fingerprint)
+
+	name := ""
+	if contacts := keyring.Contacts(); len(contacts) > 0 {
+		var err error
+		if name, err = promptWhichContact(contacts); err != nil {
+			return err
+		}
+	}
+	if name == "" {
+		var err error
+		if name, err = promptContactName(); err != nil {
+			return err
+		}
+	}
+
+	if old, ok := keyring.Contact(name); ok {
+		warnIdentityChanged(name, identity.Fingerprint(old), fingerprint)
+
+		trust, err := promptTrustChangedIdentity()
+		if err != nil {
+			return err
+		}
+		if !trust {
+			return errors.New("the identity of " + name + " has changed, key rejected")
+		}
+	} else {
+		trust, err := promptTrustNewIdentity(name)
+		if err != nil {
+			return err
+		}
+		if !trust {
+			return errors.New("the identity of " + name + " is not trusted, key rejected")
+		}
+	}
+
+	keyring.Pin(name, hello.Identity)
+	return keyring.Save(keyringPassphrase.Buffer())
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"strconv"
+
+	"ekyu.moe/soda/packager"
+)
+
+// applyMaxSize sets the largest message to encrypt or decrypt, which can be
+// overridden with $SODA_MAX_SIZE (a number of bytes).
+func applyMaxSize() error {
+	v := os.Getenv("SODA_MAX_SIZE")
+	if v == "" {
+		return nil
+	}
+
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return errors.New("bad SODA_MAX_SIZE: " + err.Error())
+	}
+	if err := packager.SetMaxSize(n); err != nil {
+		return errors.New("bad SODA_MAX_SIZE: " + err.Error())
+	}
+
+	return nil
+}
@@ -1,19 +1,15 @@
 package main
 
 import (
-	"errors"
 	"fmt"
 	"os"
-	"unsafe"
 
 	"ekyu.moe/util/cli"
 	"github.com/awnumar/memguard"
 	"golang.org/x/crypto/ssh/terminal"
 
-	"ekyu.moe/soda/codec"
 	"ekyu.moe/soda/core"
 	"ekyu.moe/soda/i18n"
-	"ekyu.moe/soda/packager"
 )
 
 var (
@@ -49,85 +45,30 @@ func realMain() int {
 	}
 	i18n.SetLocale(l)
 
-	informln("\nYour key pair is to be generated.")
-
-	// Prompt output codec
-	informln("For your own public key:")
-	encode, err := promptOutputCodec()
-	if err != nil {
+	// Limit the size of messages
+	if err := applyMaxSize(); err != nil {
 		perror(err)
 		return 1
 	}
 
-	// Prompt output method
-	write, err := promptOutputWriter()
-	if err != nil {
+	// Unlock our long-term identity
+	if err := unlockKeyring(); err != nil {
 		perror(err)
 		return 1
 	}
 
-	// Generate session (key pair)
-	session, err = core.NewSession()
+	// Prompt key exchange mode
+	kex, err := promptKeyExchange()
 	if err != nil {
 		perror(err)
 		return 1
 	}
 
-	// Append crc32 to the head
-	packet := packager.AttachCrc32(session.PublicKey()[:])
-
-	// Encode public key
-	myPubStr := encode(packet)
-
-	// Output public key
-	if err := write([]byte(myPubStr)); err != nil {
+	if err := addPartner(kex); err != nil {
 		perror(err)
 		return 1
 	}
 
-	for {
-		// Prompt input method
-		informln("\nFor your partner's public key:")
-		read, err := promptInputReader()
-		if err != nil {
-			// this one is fatal
-			perror(err)
-			return 1
-		}
-
-		// Read partner's public key
-		hisPubStr, err := read()
-		if err != nil {
-			perror(err)
-			continue
-		}
-
-		// Decode public key
-		packet := codec.DetectCodecAndDecode(string(hisPubStr))
-
-		// Validate length
-		if len(packet) != 36 {
-			perror(errors.New("wrong public key size"))
-			continue
-		}
-
-		// Check crc32
-		hisPub, ok := packager.DetachCrc32(packet)
-		if !ok {
-			perror(errors.New("crc32 checksum failed"))
-			continue
-		}
-
-		// Compute shared secret
-		hisPubArray := (*[32]byte)(unsafe.Pointer(&hisPub[0]))
-		if err := session.Compute(hisPubArray); err != nil {
-			perror(err)
-			continue
-		}
-
-		break
-	}
-
 	// Session begins
 	informf("\n\x1b[1m================= %s =================\x1b[0m\n", i18n.SESSION_BEGIN)
 
@@ -148,6 +89,13 @@ func mainLoop() (bool, error) {
 	// Print the ID (how many times mainLoop has been called without error)
 	printID()
 
+	// Ask the partner for a rekey before going on
+	if session.RekeyDue() {
+		if err := requestRekey(); err != nil {
+			return false, err
+		}
+	}
+
 	// Prompt command
 	cmd, err := promptCmd()
 	if err != nil {
@@ -164,9 +112,32 @@ func mainLoop() (bool, error) {
 	case CMD_RAND:
 		err = uuidv4()
 
+	case CMD_BROADCAST:
+		err = broadcast()
+
+	case CMD_ADD_PARTNER:
+		var kex int
+		if kex, err = promptKeyExchange(); err == nil {
+			err = addPartner(kex)
+		}
+
+	case CMD_SWITCH_PARTNER:
+		err = switchPartner()
+
+	case CMD_GROUP:
+		err = groupMenu()
+
+	case CMD_VERIFY:
+		err = verifySigned()
+
 	case CMD_CLS:
 		err = cli.ClearTerminal()
 
+	case CMD_SAVE:
+		if err = saveSession(); err == nil {
+			return true, nil
+		}
+
 	case CMD_EXIT:
 		return true, nil
 	}
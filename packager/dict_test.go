@@ -0,0 +1,60 @@
+package packager
+
+import (
+	"bufio"
+	"os"
+	"strings"
+	"testing"
+)
+
+func sampleMessages(t *testing.T) []string {
+	t.Helper()
+
+	f, err := os.Open("testdata/chat.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	var msgs []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if line := scanner.Text(); line != "" && !strings.HasPrefix(line, "#") {
+			msgs = append(msgs, line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	return msgs
+}
+
+func TestDictionary(t *testing.T) {
+	raw, packed, dict := 0, 0, 0
+	for _, msg := range sampleMessages(t) {
+		packet := pack(t, msg, PadNone, nil)
+		plain, h, _, err := Unpack(packet)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(plain.Buffer()) != msg {
+			t.Fatalf("got %q, want %q", plain.Buffer(), msg)
+		}
+
+		raw += len(msg)
+		packed += packet.Size()
+		if h.Compression == CompressDict {
+			dict++
+		}
+		plain.Destroy()
+		packet.Destroy()
+	}
+
+	if packed >= raw {
+		t.Fatalf("%d bytes of messages are packed into %d bytes", raw, packed)
+	}
+	if dict == 0 {
+		t.Fatal("the dictionary is never used")
+	}
+}
@@ -0,0 +1,176 @@
+//go:build ignore
+// +build ignore
+
+// gendict trains the preset dictionary of CompressDict on the sample chat
+// messages in testdata/chat.txt, and writes it to dict.go.
+//
+// Every substring of a message, cut at rune boundaries, is scored by how many
+// bytes DEFLATE saves by referring to it in each message it appears in. The
+// best ones are taken greedily, skipping those already in the dictionary,
+// until it is full. The best ones are put last, where they are the cheapest
+// to refer to.
+//
+// Run it with go generate. Note that the dictionary is part of the packet
+// format, see dict.go.
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"go/format"
+	"io/ioutil"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	// dictSize is the maximum size of the dictionary.
+	dictSize = 2048
+
+	// A DEFLATE match is 3 to 258 bytes long, and costs about 3 bytes.
+	minLen   = 4
+	maxLen   = 48
+	matchLen = 3
+)
+
+type candidate struct {
+	s     string
+	score int
+}
+
+func main() {
+	msgs, err := readMessages("testdata/chat.txt")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// How many messages each substring appears in
+	freq := make(map[string]int)
+	for _, msg := range msgs {
+		seen := make(map[string]bool)
+		for i := 0; i < len(msg); {
+			for j := i; j < len(msg) && j-i <= maxLen; {
+				_, n := utf8.DecodeRuneInString(msg[j:])
+				j += n
+				if sub := msg[i:j]; j-i >= minLen && j-i <= maxLen && !seen[sub] {
+					seen[sub] = true
+					freq[sub]++
+				}
+			}
+			_, n := utf8.DecodeRuneInString(msg[i:])
+			i += n
+		}
+	}
+
+	var candidates []candidate
+	for s, f := range freq {
+		if f < 2 {
+			continue
+		}
+		candidates = append(candidates, candidate{s, f * (len(s) - matchLen)})
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		if candidates[i].score != candidates[j].score {
+			return candidates[i].score > candidates[j].score
+		}
+		return candidates[i].s < candidates[j].s
+	})
+
+	var picked []string
+	size := 0
+	for _, c := range candidates {
+		if size+len(c.s) > dictSize {
+			continue
+		}
+		if inAny(picked, c.s) {
+			continue
+		}
+
+		// Those in c.s are no longer needed.
+		kept := picked[:0]
+		for _, p := range picked {
+			if strings.Contains(c.s, p) {
+				size -= len(p)
+				continue
+			}
+			kept = append(kept, p)
+		}
+		picked = append(kept, c.s)
+		size += len(c.s)
+	}
+
+	// The best ones last
+	for i, j := 0, len(picked)-1; i < j; i, j = i+1, j-1 {
+		picked[i], picked[j] = picked[j], picked[i]
+	}
+
+	if err := write("dict.go", picked); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func readMessages(name string) ([]string, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var msgs []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		msgs = append(msgs, line)
+	}
+
+	return msgs, scanner.Err()
+}
+
+func inAny(picked []string, s string) bool {
+	for _, p := range picked {
+		if strings.Contains(p, s) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func write(name string, picked []string) error {
+	buf := new(bytes.Buffer)
+	fmt.Fprint(buf, `// Code generated by gendict.go; DO NOT EDIT.
+
+package packager
+
+//go:generate go run gendict.go
+
+// dictionary is the preset dictionary of CompressDict, trained by gendict.go
+// on the sample chat messages in testdata/chat.txt, in the languages soda
+// speaks. DEFLATE can refer back to it from the first byte of a message, which
+// is where zlib alone has nothing to refer to.
+//
+// It is part of the packet format: once released, it must never change. A
+// better one needs a new Compression.
+var dictionary = []byte(
+`)
+	quoted := make([]string, len(picked))
+	for i, s := range picked {
+		quoted[i] = strconv.Quote(s)
+	}
+	fmt.Fprintf(buf, "%s,\n)\n", strings.Join(quoted, " +\n"))
+
+	src, err := format.Source(buf.Bytes())
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(name, src, 0644)
+}
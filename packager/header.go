@@ -0,0 +1,80 @@
+package packager
+
+import (
+	"errors"
+	"strconv"
+)
+
+// packetVersion is the version of the inner packet format.
+const packetVersion = 1
+
+// Compression is how the body of a packet is compressed.
+type Compression byte
+
+const (
+	CompressNone Compression = iota
+	CompressZlib
+
+	// CompressDict is raw DEFLATE with a preset dictionary, which does much
+	// better than zlib on short chat messages.
+	CompressDict
+)
+
+// Content is what the body of a packet is.
+type Content byte
+
+const (
+	ContentText Content = iota
+	ContentBinary
+
+	// ContentSenderKey is a sender key of a group, see core.Group. It is
+	// only accepted from a pairwise session.
+	ContentSenderKey
+)
+
+// Header is the header of a packet, which tells Unpack how to read the rest of
+// it, rather than having it guess.
+//
+// Format:
+//     version[1] + flags[1]
+// where the bits of flags are, from the lowest,
+//     compression[2] + padding[2] + content[2] + reserved[2]
+// and the reserved bits must be zero.
+type Header struct {
+	Compression Compression
+	Padding     Padding
+	Content     Content
+}
+
+func (h *Header) marshal() []byte {
+	flags := byte(h.Compression) | byte(h.Padding)<<2 | byte(h.Content)<<4
+	return []byte{packetVersion, flags}
+}
+
+func parseHeader(b []byte) (*Header, error) {
+	if len(b) < 2 {
+		return nil, errors.New("packet: too short")
+	}
+	if b[0] != packetVersion {
+		return nil, errors.New("packet: unsupported version " + strconv.Itoa(int(b[0])) + ", please upgrade soda")
+	}
+
+	flags := b[1]
+	if flags>>6 != 0 {
+		return nil, errors.New("packet: unknown flags")
+	}
+
+	h := &Header{
+		Compression: Compression(flags & 3),
+		Padding:     Padding(flags >> 2 & 3),
+		Content:     Content(flags >> 4 & 3),
+	}
+	if h.Compression > CompressDict {
+		return nil, errors.New("packet: unknown compression")
+	}
+	if h.Content > ContentSenderKey {
+		return nil, errors.New("packet: unknown content type")
+	}
+
+	return h, nil
+}
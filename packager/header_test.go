@@ -0,0 +1,59 @@
+package packager
+
+import (
+	"testing"
+)
+
+func TestHeader(t *testing.T) {
+	for _, h := range []Header{
+		{},
+		{Compression: CompressDict, Padding: PadBlock, Content: ContentSenderKey},
+		{Compression: CompressZlib, Padding: PadPADME, Content: ContentBinary},
+	} {
+		got, err := parseHeader(h.marshal())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if *got != h {
+			t.Fatalf("got %+v, want %+v", *got, h)
+		}
+	}
+}
+
+func TestHeaderBad(t *testing.T) {
+	for _, bad := range [][]byte{
+		{},
+		{packetVersion},
+		{packetVersion + 1, 0},
+		{packetVersion, 3},
+		{packetVersion, 3 << 4},
+		{packetVersion, 1 << 6},
+	} {
+		if _, err := parseHeader(bad); err == nil {
+			t.Fatalf("%x is parsed", bad)
+		}
+	}
+}
+
+// The header says how the body is compressed, a plain text that looks
+// compressed comes out as it is.
+func TestHeaderNoGuessing(t *testing.T) {
+	orig := lockedBytes(t, []byte{0x78, 0x9c, 1, 2})
+	defer orig.Destroy()
+
+	packet, err := Pack(orig, PadNone, ContentBinary, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer packet.Destroy()
+
+	plain, h, _, err := Unpack(packet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer plain.Destroy()
+
+	if string(plain.Buffer()) != "\x78\x9c\x01\x02" || h.Compression != CompressNone || h.Content != ContentBinary {
+		t.Fatalf("got %x with %+v", plain.Buffer(), h)
+	}
+}
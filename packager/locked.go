@@ -0,0 +1,128 @@
+package packager
+
+import (
+	"io"
+
+	"github.com/awnumar/memguard"
+)
+
+// initialSize is how much locked memory a lockedWriter starts with.
+const initialSize = 16 * 1024
+
+// lockedWriter collects what is written into locked memory, which is doubled
+// whenever it runs out, up to limit bytes in total. Nothing written to it ever
+// lands on the heap.
+type lockedWriter struct {
+	buf   *memguard.LockedBuffer
+	n     int
+	limit int
+}
+
+func newLockedWriter(limit int) (*lockedWriter, error) {
+	size := initialSize
+	if size > limit {
+		size = limit
+	}
+
+	buf, err := memguard.NewMutable(size)
+	if err != nil {
+		return nil, err
+	}
+
+	return &lockedWriter{
+		buf:   buf,
+		limit: limit,
+	}, nil
+}
+
+func (w *lockedWriter) Write(p []byte) (int, error) {
+	if err := w.reserve(len(p)); err != nil {
+		return 0, err
+	}
+
+	copy(w.buf.Buffer()[w.n:], p)
+	w.n += len(p)
+
+	return len(p), nil
+}
+
+// ReadFrom reads r into the locked memory directly, so that io.Copy does not
+// go through a buffer of its own.
+func (w *lockedWriter) ReadFrom(r io.Reader) (int64, error) {
+	var total int64
+	for {
+		if w.n == w.buf.Size() {
+			if err := w.reserve(1); err != nil {
+				// Only an error if there is something left
+				var probe [1]byte
+				if n, _ := io.ReadFull(r, probe[:]); n == 0 {
+					return total, nil
+				}
+				return total, err
+			}
+		}
+
+		n, err := r.Read(w.buf.Buffer()[w.n:])
+		w.n += n
+		total += int64(n)
+		if err == io.EOF {
+			return total, nil
+		}
+		if err != nil {
+			return total, err
+		}
+	}
+}
+
+// reserve makes room for n more bytes.
+func (w *lockedWriter) reserve(n int) error {
+	if n > w.limit-w.n {
+		return ErrTooLarge
+	}
+	if w.n+n <= w.buf.Size() {
+		return nil
+	}
+
+	size := w.buf.Size() * 2
+	for size < w.n+n {
+		size *= 2
+	}
+	if size > w.limit {
+		size = w.limit
+	}
+
+	buf, err := memguard.NewMutable(size)
+	if err != nil {
+		return err
+	}
+	copy(buf.Buffer(), w.buf.Buffer()[:w.n])
+	w.buf.Destroy()
+	w.buf = buf
+
+	return nil
+}
+
+// finish returns what has been written, immutable. The writer can no longer
+// be used afterwards.
+func (w *lockedWriter) finish() (*memguard.LockedBuffer, error) {
+	defer w.buf.Destroy()
+
+	if w.n == 0 {
+		return nil, ErrEmpty
+	}
+
+	ret, err := memguard.Trim(w.buf, 0, w.n)
+	if err != nil {
+		return nil, err
+	}
+	if err := ret.MakeImmutable(); err != nil {
+		ret.Destroy()
+		return nil, err
+	}
+
+	return ret, nil
+}
+
+func (w *lockedWriter) destroy() {
+	w.buf.Destroy()
+}
@@ -0,0 +1,102 @@
+package packager
+
+import (
+	"crypto/ed25519"
+	"errors"
+	"time"
+
+	"ekyu.moe/leb128"
+)
+
+const (
+	flagExpiry = 1 << iota
+	flagBurn
+	flagSigned
+)
+
+// Meta is packed along with the plain text, and sealed with it, so that it
+// can't be tampered with.
+type Meta struct {
+	// Expiry is when the message can no longer be read. Zero for never.
+	Expiry time.Time
+
+	// Burn asks the partner to erase the message from the screen soon after
+	// reading it.
+	Burn bool
+
+	// Signer is the identity public key the plain text is signed with, and
+	// Signature is the signature. Both are nil for unsigned messages.
+	Signer    ed25519.PublicKey
+	Signature []byte
+}
+
+// Expired reports whether the message is past its expiry.
+func (m *Meta) Expired() bool {
+	return !m.Expiry.IsZero() && time.Now().After(m.Expiry)
+}
+
+// marshal encodes meta, which Pack puts right after the header, inside the
+// padding, so that the padded length does not tell whether a message is
+// signed or expires.
+//
+// Format:
+//     flags[1] + optional(uleb128(expiry in unix seconds)) +
+//     optional(signer[32] + signature[64])
+func (m *Meta) marshal() ([]byte, error) {
+	var flags byte
+	ret := []byte{0}
+	if !m.Expiry.IsZero() {
+		flags |= flagExpiry
+		ret = leb128.AppendUleb128(ret, uint64(m.Expiry.Unix()))
+	}
+	if m.Burn {
+		flags |= flagBurn
+	}
+	if m.Signature != nil {
+		if len(m.Signer) != ed25519.PublicKeySize || len(m.Signature) != ed25519.SignatureSize {
+			return nil, errors.New("meta: bad signature")
+		}
+		flags |= flagSigned
+		ret = append(ret, m.Signer...)
+		ret = append(ret, m.Signature...)
+	}
+	ret[0] = flags
+
+	return ret, nil
+}
+
+// parseMeta decodes the meta at the beginning of b, returning it along with
+// its length.
+func parseMeta(b []byte) (*Meta, int, error) {
+	if len(b) < 1 {
+		return nil, 0, errors.New("meta: packet too short")
+	}
+
+	flags := b[0]
+	if flags&^(flagExpiry|flagBurn|flagSigned) != 0 {
+		return nil, 0, errors.New("meta: unknown flags")
+	}
+
+	m := new(Meta)
+	pos := 1
+	if flags&flagExpiry != 0 {
+		expiry, n := leb128.DecodeUleb128(b[pos:])
+		if n == 0 || expiry == 0 {
+			return nil, 0, errors.New("meta: bad expiry")
+		}
+		m.Expiry = time.Unix(int64(expiry), 0)
+		pos += int(n)
+	}
+	m.Burn = flags&flagBurn != 0
+	if flags&flagSigned != 0 {
+		if len(b)-pos < ed25519.PublicKeySize+ed25519.SignatureSize {
+			return nil, 0, errors.New("meta: packet too short")
+		}
+		m.Signer = append(ed25519.PublicKey(nil), b[pos:pos+ed25519.PublicKeySize]...)
+		pos += ed25519.PublicKeySize
+		m.Signature = append([]byte(nil), b[pos:pos+ed25519.SignatureSize]...)
+		pos += ed25519.SignatureSize
+	}
+
+	return m, pos, nil
+}
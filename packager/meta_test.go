@@ -0,0 +1,119 @@
+package packager
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/awnumar/memguard"
+)
+
+// pack packs msg, failing t on error.
+func pack(t *testing.T, msg string, padding Padding, meta *Meta) *memguard.LockedBuffer {
+	t.Helper()
+
+	orig, err := memguard.NewImmutableFromBytes([]byte(msg))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer orig.Destroy()
+
+	packet, err := Pack(orig, padding, ContentText, meta)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return packet
+}
+
+func signedMeta() *Meta {
+	return &Meta{
+		Expiry:    time.Unix(2000000000, 0),
+		Burn:      true,
+		Signer:    bytes.Repeat([]byte{7}, 32),
+		Signature: bytes.Repeat([]byte{9}, 64),
+	}
+}
+
+func TestMeta(t *testing.T) {
+	for _, m := range []*Meta{
+		nil,
+		{},
+		{Burn: true},
+		{Expiry: time.Unix(2000000000, 0)},
+		{Expiry: time.Unix(1, 0), Burn: true},
+		signedMeta(),
+	} {
+		packet := pack(t, "hello", DefaultPadding, m)
+		plain, _, got, err := Unpack(packet)
+		packet.Destroy()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(plain.Buffer()) != "hello" {
+			t.Fatalf("got %q", plain.Buffer())
+		}
+		plain.Destroy()
+
+		if m == nil {
+			m = new(Meta)
+		}
+		if !got.Expiry.Equal(m.Expiry) || got.Burn != m.Burn ||
+			!bytes.Equal(got.Signer, m.Signer) || !bytes.Equal(got.Signature, m.Signature) {
+			t.Fatalf("got %+v, want %+v", got, m)
+		}
+		if got.Expired() != (m.Expiry.Unix() == 1) {
+			t.Fatalf("Expired is %v for %v", got.Expired(), m.Expiry)
+		}
+	}
+}
+
+func TestMetaBadSignature(t *testing.T) {
+	orig, _ := memguard.NewImmutableFromBytes([]byte("hello"))
+	defer orig.Destroy()
+
+	m := &Meta{Signer: make([]byte, 31), Signature: make([]byte, 64)}
+	if _, err := Pack(orig, DefaultPadding, ContentText, m); err == nil {
+		t.Fatal("a bad signature is packed")
+	}
+}
+
+// The meta is inside the padding, so it only changes the padded length when
+// it makes the packet outgrow its bucket, as any longer plain text would.
+func TestMetaPadded(t *testing.T) {
+	unsigned := pack(t, "yes", PadBlock, nil)
+	defer unsigned.Destroy()
+	expiring := pack(t, "yes", PadBlock, &Meta{Expiry: time.Unix(2000000000, 0), Burn: true})
+	defer expiring.Destroy()
+	signed := pack(t, "yes", PadBlock, signedMeta())
+	defer signed.Destroy()
+
+	if unsigned.Size() != BlockSize || expiring.Size() != BlockSize || signed.Size() != BlockSize {
+		t.Fatalf("got %d, %d and %d bytes", unsigned.Size(), expiring.Size(), signed.Size())
+	}
+
+	pow := pack(t, "yes", PadPowerOfTwo, signedMeta())
+	defer pow.Destroy()
+	if n := pow.Size(); n&(n-1) != 0 {
+		t.Fatalf("got %d bytes", n)
+	}
+}
+
+func TestMetaBad(t *testing.T) {
+	header := (&Header{Padding: PadNone}).marshal()
+	for _, meta := range [][]byte{
+		{0x80},
+		{flagExpiry, 0},
+		{flagSigned, 1, 2, 3},
+	} {
+		packet, err := pad(append(append([]byte(nil), header...), meta...), []byte("hello"), PadNone)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if plain, _, _, err := Unpack(packet); err == nil {
+			plain.Destroy()
+			t.Fatalf("meta %x is accepted", meta)
+		}
+		packet.Destroy()
+	}
+}
@@ -2,25 +2,46 @@ package packager // import "ekyu.moe/soda/packager"
 
 import (
 	"bytes"
+	"compress/flate"
 	"compress/zlib"
 	"encoding/binary"
+	"errors"
 	"hash/crc32"
-	"io/ioutil"
+	"io"
+	"runtime"
 
 	"github.com/awnumar/memguard"
 )
 
+// DefaultMaxSize is the largest plain text Pack and Unpack handle unless told
+// otherwise by SetMaxSize.
+const DefaultMaxSize = 1 << 20
+
 var (
-	globalBuffer *memguard.LockedBuffer
+	// ErrTooLarge is returned when a plain text is over the maximum size.
+	ErrTooLarge = errors.New("packet: message too large")
+
+	// ErrEmpty is returned when a packet holds nothing.
+	ErrEmpty = errors.New("packet: empty body")
+
+	maxSize = DefaultMaxSize
 )
 
-func init() {
-	buf, err := memguard.NewImmutable(16 * 1024)
-	if err != nil {
-		panic("buffer init: " + err.Error())
+// SetMaxSize sets the largest plain text Pack and Unpack handle. A larger one
+// fails with ErrTooLarge rather than taking up all the locked memory, or
+// being a decompression bomb.
+func SetMaxSize(n int) error {
+	if n <= 0 {
+		return errors.New("packet: the maximum size must be positive")
 	}
 
-	globalBuffer = buf
+	maxSize = n
+	return nil
+}
+
+// MaxSize returns the size set by SetMaxSize.
+func MaxSize() int {
+	return maxSize
 }
 
 func AttachCrc32(content []byte) []byte {
@@ -34,6 +55,10 @@ func AttachCrc32(content []byte) []byte {
 }
 
 func DetachCrc32(content []byte) ([]byte, bool) {
+	if len(content) < 4 {
+		return nil, false
+	}
+
 	actual := crc32.Checksum(content[4:], crc32.IEEETable)
 	expected := binary.BigEndian.Uint32(content[:4])
 
@@ -44,91 +69,204 @@ func DetachCrc32(content []byte) ([]byte, bool) {
 	return nil, false
 }
 
-// Pack tries to compress orig, the return value may be compress or not.
-// If ever an error is returned, then it must be a fatal one.
-func Pack(orig *memguard.LockedBuffer) (*memguard.LockedBuffer, error) {
+// Pack compresses orig with whichever method makes it smallest, then puts it
+// in a packet along with meta, which is padded with padding. A nil meta is
+// the same as an empty one. orig is not destroyed. If ever an error is
+// returned, then it must be a fatal one.
+//
+// Format:
+//     header + meta + body + padding
+func Pack(orig *memguard.LockedBuffer, padding Padding, content Content, meta *Meta) (*memguard.LockedBuffer, error) {
 	// This is an assertion.
 	if orig.IsMutable() {
 		panic("packet must be immutable")
 	}
+	if orig.Size() > maxSize {
+		return nil, ErrTooLarge
+	}
 
-	if err := globalBuffer.MakeMutable(); err != nil {
+	if meta == nil {
+		meta = new(Meta)
+	}
+	m, err := meta.marshal()
+	if err != nil {
 		return nil, err
 	}
-	defer globalBuffer.MakeImmutable()
-	defer globalBuffer.Wipe()
 
-	// 尝试压缩
-	buf := bytes.NewBuffer(globalBuffer.Buffer()[:0])
-	z, err := zlib.NewWriterLevel(buf, zlib.BestCompression)
-	// 遇到错误直接选择不压缩
+	body, compression, err := compress(orig)
 	if err != nil {
-		return orig, nil
+		return nil, err
 	}
-	defer z.Close()
-
-	if _, err := z.Write(orig.Buffer()); err != nil {
-		return orig, nil
+	if body != orig {
+		defer body.Destroy()
 	}
-	if err := z.Close(); err != nil {
-		return orig, nil
+
+	h := &Header{
+		Compression: compression,
+		Padding:     padding,
+		Content:     content,
 	}
 
-	// Compare the sizes
-	l := buf.Len()
-	if l >= orig.Size() {
-		// log.Println("no compress")
-		return orig, nil
+	return pad(append(h.marshal(), m...), body.Buffer(), padding)
+}
+
+// compress tries every compression method on orig and keeps the smallest
+// result, which may be orig itself.
+func compress(orig *memguard.LockedBuffer) (*memguard.LockedBuffer, Compression, error) {
+	best, method := orig, CompressNone
+	for _, m := range []Compression{CompressZlib, CompressDict} {
+		// Only worth it if it comes out smaller
+		if best.Size() < 2 {
+			break
+		}
+
+		ret, err := compressWith(orig, m, best.Size()-1)
+		if err != nil {
+			if best != orig {
+				best.Destroy()
+			}
+			return nil, 0, err
+		}
+		if ret == nil {
+			continue
+		}
+
+		if best != orig {
+			best.Destroy()
+		}
+		best, method = ret, m
 	}
-	// log.Println("compress")
 
-	// these errors are all fatal
-	ret, err := memguard.Trim(globalBuffer, 0, l)
+	return best, method, nil
+}
+
+// compressWith compresses orig with method, or returns nil if the result does
+// not fit in limit bytes.
+func compressWith(orig *memguard.LockedBuffer, method Compression, limit int) (*memguard.LockedBuffer, error) {
+	w, err := newLockedWriter(limit)
 	if err != nil {
 		return nil, err
 	}
 
-	if err := ret.MakeImmutable(); err != nil {
-		ret.Destroy()
-		return nil, err
+	// 尝试压缩
+	var z io.WriteCloser
+	switch method {
+	case CompressZlib:
+		z, err = zlib.NewWriterLevel(w, zlib.BestCompression)
+	case CompressDict:
+		z, err = flate.NewWriterDict(w, flate.BestCompression, dictionary)
+	}
+	// 遇到错误直接选择不压缩
+	if err != nil {
+		w.destroy()
+		return nil, nil
 	}
 
-	return ret, nil
+	// Any error, including the output growing past the limit, means this
+	// method is no good.
+	if _, err := z.Write(orig.Buffer()); err != nil {
+		w.destroy()
+		return nil, nil
+	}
+	if err := z.Close(); err != nil {
+		w.destroy()
+		return nil, nil
+	}
+
+	// these errors are all fatal
+	return w.finish()
 }
 
-// Unpack tries to decompress orig, the return value may be decompress or not.
-// If ever an error is returned, then it must be a fatal one.
-func Unpack(orig *memguard.LockedBuffer) (*memguard.LockedBuffer, error) {
+// Unpack removes the padding of orig, then decompresses it as its header
+// says, returning the plain text along with the header and the meta. orig is
+// not destroyed.
+func Unpack(orig *memguard.LockedBuffer) (*memguard.LockedBuffer, *Header, *Meta, error) {
 	// Assert
 	if orig.IsMutable() {
 		panic("packet must be immutable")
 	}
 
-	// Try decompress
-	r := bytes.NewReader(orig.Buffer())
-	z, err := zlib.NewReader(r)
-	// Once an error is met, return orig.
-	// However this is risky, as it is possible to be an occasional error
-	// with its content indeed compressed.
+	packet, err := unpad(orig)
 	if err != nil {
-		return orig, nil
+		return nil, nil, nil, err
 	}
-	defer z.Close()
+	defer packet.Destroy()
 
-	// I can't come up with a safer idea at the moment
-	decompressed, err := ioutil.ReadAll(z)
+	h, err := parseHeader(packet.Buffer())
 	if err != nil {
-		return orig, nil
+		return nil, nil, nil, err
 	}
-	if err := z.Close(); err != nil {
-		return orig, nil
+	meta, n, err := parseMeta(packet.Buffer()[2:])
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	n += 2
+
+	if packet.Size() == n {
+		return nil, nil, nil, ErrEmpty
+	}
+	if h.Compression == CompressNone && packet.Size()-n > maxSize {
+		return nil, nil, nil, ErrTooLarge
 	}
 
-	ret, err := memguard.NewImmutableFromBytes(decompressed)
+	body, err := memguard.Trim(packet, n, packet.Size()-n)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if err := body.MakeImmutable(); err != nil {
+		body.Destroy()
+		return nil, nil, nil, err
+	}
+
+	if h.Compression == CompressNone {
+		return body, h, meta, nil
+	}
+	defer body.Destroy()
+
+	plain, err := decompress(body, h.Compression)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	return plain, h, meta, nil
+}
+
+// decompress decompresses a body into locked memory, up to the maximum size.
+func decompress(body *memguard.LockedBuffer, method Compression) (*memguard.LockedBuffer, error) {
+	var z io.ReadCloser
+	switch method {
+	case CompressZlib:
+		var err error
+		if z, err = zlib.NewReader(bytes.NewReader(body.Buffer())); err != nil {
+			return nil, errors.New("packet: bad compressed body")
+		}
+	case CompressDict:
+		z = flate.NewReaderDict(bytes.NewReader(body.Buffer()), dictionary)
+	default:
+		return nil, errors.New("packet: unknown compression")
+	}
+	defer z.Close()
+
+	w, err := newLockedWriter(maxSize)
 	if err != nil {
-		ret.Destroy()
 		return nil, err
 	}
 
-	return ret, nil
+	_, err = w.ReadFrom(z)
+	// Without this, the finalizer of body may destroy it while z is still
+	// reading its memory, as a deferred Destroy does not keep body alive.
+	runtime.KeepAlive(body)
+	if err != nil {
+		w.destroy()
+		if err == ErrTooLarge {
+			return nil, err
+		}
+		return nil, errors.New("packet: bad compressed body")
+	}
+	if err := z.Close(); err != nil {
+		w.destroy()
+		return nil, errors.New("packet: bad compressed body")
+	}
+
+	return w.finish()
 }
@@ -0,0 +1,146 @@
+package packager
+
+import (
+	"bytes"
+	"compress/zlib"
+	"strings"
+	"testing"
+
+	"github.com/awnumar/memguard"
+)
+
+// rawPacket puts body in a packet with the header h and an empty meta,
+// compressed or not, which Pack would never do.
+func rawPacket(t *testing.T, h *Header, body []byte) *memguard.LockedBuffer {
+	t.Helper()
+
+	packet, err := pad(append(h.marshal(), 0), body, PadNone)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return packet
+}
+
+func TestPack(t *testing.T) {
+	for _, msg := range []string{
+		"a",
+		"hello",
+		strings.Repeat("hello, world! ", 100),
+		strings.Repeat("x", 3*initialSize),
+	} {
+		packet := pack(t, msg, DefaultPadding, nil)
+		plain, h, _, err := Unpack(packet)
+		packet.Destroy()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(plain.Buffer()) != msg || h.Content != ContentText {
+			t.Fatalf("got %d bytes with %+v", plain.Size(), h)
+		}
+		plain.Destroy()
+	}
+}
+
+func TestMaxSize(t *testing.T) {
+	defer SetMaxSize(DefaultMaxSize)
+
+	if err := SetMaxSize(0); err == nil {
+		t.Fatal("a maximum size of zero is accepted")
+	}
+	if err := SetMaxSize(100); err != nil {
+		t.Fatal(err)
+	}
+
+	orig := lockedBytes(t, bytes.Repeat([]byte{'a'}, 101))
+	defer orig.Destroy()
+	if _, err := Pack(orig, PadNone, ContentText, nil); err != ErrTooLarge {
+		t.Fatalf("got %v, want ErrTooLarge", err)
+	}
+
+	// Not compressed
+	packet := rawPacket(t, &Header{}, bytes.Repeat([]byte{'a'}, 101))
+	defer packet.Destroy()
+	if _, _, _, err := Unpack(packet); err != ErrTooLarge {
+		t.Fatalf("got %v, want ErrTooLarge", err)
+	}
+}
+
+// A small body that decompresses to more than the maximum size is cut off
+// rather than taking up all the memory.
+func TestDecompressionBomb(t *testing.T) {
+	var z bytes.Buffer
+	w := zlib.NewWriter(&z)
+	w.Write(make([]byte, DefaultMaxSize+1))
+	w.Close()
+
+	packet := rawPacket(t, &Header{Compression: CompressZlib}, z.Bytes())
+	defer packet.Destroy()
+
+	if _, _, _, err := Unpack(packet); err != ErrTooLarge {
+		t.Fatalf("got %v, want ErrTooLarge", err)
+	}
+}
+
+func TestDecompressBad(t *testing.T) {
+	for _, c := range []Compression{CompressZlib, CompressDict} {
+		packet := rawPacket(t, &Header{Compression: c}, []byte("not compressed"))
+		if _, _, _, err := Unpack(packet); err == nil {
+			t.Fatalf("%v: a bad compressed body is accepted", c)
+		}
+		packet.Destroy()
+	}
+}
+
+func TestLockedWriter(t *testing.T) {
+	w, err := newLockedWriter(3 * initialSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	chunk := bytes.Repeat([]byte{'a'}, initialSize)
+	for i := 0; i < 3; i++ {
+		if _, err := w.Write(chunk); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := w.Write([]byte{'a'}); err != ErrTooLarge {
+		t.Fatalf("got %v, want ErrTooLarge", err)
+	}
+
+	buf, err := w.finish()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer buf.Destroy()
+	if buf.Size() != 3*initialSize || buf.IsMutable() {
+		t.Fatalf("got %d bytes, mutable %v", buf.Size(), buf.IsMutable())
+	}
+
+	// ReadFrom stops at the limit only if there is more to read.
+	w, err = newLockedWriter(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.ReadFrom(bytes.NewReader(make([]byte, 10))); err != nil {
+		t.Fatal(err)
+	}
+	w.destroy()
+
+	w, err = newLockedWriter(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.ReadFrom(bytes.NewReader(make([]byte, 11))); err != ErrTooLarge {
+		t.Fatalf("got %v, want ErrTooLarge", err)
+	}
+	w.destroy()
+
+	w, err = newLockedWriter(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.finish(); err != ErrEmpty {
+		t.Fatalf("got %v, want ErrEmpty", err)
+	}
+}
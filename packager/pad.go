@@ -0,0 +1,129 @@
+package packager
+
+import (
+	"errors"
+	"math/bits"
+
+	"github.com/awnumar/memguard"
+)
+
+// Padding is a scheme to round the length of a packet up, so that the length
+// of the encrypted text tells less about the plain text.
+type Padding byte
+
+const (
+	// PadNone only appends the end marker.
+	PadNone Padding = iota
+
+	// PadPowerOfTwo rounds up to the next power of two, which hides the most
+	// but costs up to twice the size.
+	PadPowerOfTwo
+
+	// PadPADME rounds up so that only the top bits of the length are
+	// significant, which costs no more than 12% of the size.
+	PadPADME
+
+	// PadBlock rounds up to a multiple of BlockSize.
+	PadBlock
+)
+
+// BlockSize is the block size of PadBlock.
+const BlockSize = 256
+
+// DefaultPadding is used unless told otherwise.
+const DefaultPadding = PadPADME
+
+// minPadded is the size short packets are padded to, since those are where
+// the length says the most.
+const minPadded = 32
+
+func (p Padding) String() string {
+	switch p {
+	case PadNone:
+		return "None"
+	case PadPowerOfTwo:
+		return "Power of two"
+	case PadPADME:
+		return "PADMÉ"
+	case PadBlock:
+		return "Fixed blocks"
+	default:
+		return "Unknown"
+	}
+}
+
+// paddedSize returns the size a packet of n bytes, including the end marker,
+// is padded to.
+func (p Padding) paddedSize(n int) int {
+	if p != PadNone && n < minPadded {
+		n = minPadded
+	}
+
+	switch p {
+	case PadPowerOfTwo:
+		return 1 << uint(bits.Len(uint(n-1)))
+
+	case PadPADME:
+		// See "Reducing Metadata Leakage from Encrypted Files and
+		// Communication with PURBs", by Nikitin et al.
+		e := bits.Len(uint(n)) - 1
+		s := bits.Len(uint(e))
+		mask := 1<<uint(e-s) - 1
+		return (n + mask) &^ mask
+
+	case PadBlock:
+		return (n + BlockSize - 1) / BlockSize * BlockSize
+
+	default:
+		return n
+	}
+}
+
+// pad joins head and body and pads them with an end marker 0x80 followed by
+// zeros, as in ISO/IEC 7816-4, so that the padding can be removed without
+// knowing the scheme.
+//
+// Format:
+//     head + body + 0x80 + 0x00...
+func pad(head, body []byte, p Padding) (*memguard.LockedBuffer, error) {
+	n := len(head) + len(body)
+
+	ret, err := memguard.NewMutable(p.paddedSize(n + 1))
+	if err != nil {
+		return nil, err
+	}
+	copy(ret.Buffer(), head)
+	copy(ret.Buffer()[len(head):], body)
+	ret.Buffer()[n] = 0x80
+
+	if err := ret.MakeImmutable(); err != nil {
+		ret.Destroy()
+		return nil, err
+	}
+
+	return ret, nil
+}
+
+// unpad removes the padding added by pad. packet is not destroyed.
+func unpad(packet *memguard.LockedBuffer) (*memguard.LockedBuffer, error) {
+	buf := packet.Buffer()
+
+	i := len(buf) - 1
+	for i >= 0 && buf[i] == 0 {
+		i--
+	}
+	if i < 1 || buf[i] != 0x80 {
+		return nil, errors.New("packet: bad padding")
+	}
+
+	ret, err := memguard.Trim(packet, 0, i)
+	if err != nil {
+		return nil, err
+	}
+	if err := ret.MakeImmutable(); err != nil {
+		ret.Destroy()
+		return nil, err
+	}
+
+	return ret, nil
+}
@@ -0,0 +1,93 @@
+package packager
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/awnumar/memguard"
+)
+
+// lockedBytes returns an immutable copy of b.
+func lockedBytes(t *testing.T, b []byte) *memguard.LockedBuffer {
+	t.Helper()
+
+	ret, err := memguard.NewImmutableFromBytes(append([]byte(nil), b...))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return ret
+}
+
+func TestPaddedSize(t *testing.T) {
+	for _, c := range []struct {
+		p    Padding
+		n    int
+		want int
+	}{
+		{PadNone, 1, 1},
+		{PadNone, 100, 100},
+		{PadPowerOfTwo, 1, 32},
+		{PadPowerOfTwo, 33, 64},
+		{PadPowerOfTwo, 64, 64},
+		{PadPowerOfTwo, 1000, 1024},
+		{PadPADME, 9, 32},
+		{PadPADME, 100, 104},
+		{PadPADME, 1000, 1024},
+		{PadBlock, 1, BlockSize},
+		{PadBlock, BlockSize + 1, 2 * BlockSize},
+	} {
+		if got := c.p.paddedSize(c.n); got != c.want {
+			t.Errorf("%v of %d: got %d, want %d", c.p, c.n, got, c.want)
+		}
+	}
+
+	// PADMÉ costs no more than 12%.
+	for n := minPadded; n < 100000; n += 97 {
+		if got := PadPADME.paddedSize(n); got < n || float64(got) > float64(n)*1.12 {
+			t.Fatalf("PADMÉ of %d: got %d", n, got)
+		}
+	}
+}
+
+func TestPadding(t *testing.T) {
+	for _, p := range []Padding{PadNone, PadPowerOfTwo, PadPADME, PadBlock} {
+		for _, n := range []int{1, 2, 31, 32, 33, 255, 256, 1000} {
+			// Ends with a zero, like the padding does.
+			msg := strings.Repeat("\x01", n-1) + "\x00"
+
+			packet := pack(t, msg, p, nil)
+			size := packet.Size()
+			switch {
+			case p == PadPowerOfTwo && size&(size-1) != 0,
+				p == PadBlock && size%BlockSize != 0,
+				p != PadNone && size < minPadded:
+				t.Fatalf("%v of %d bytes: got %d bytes", p, n, size)
+			}
+
+			plain, h, _, err := Unpack(packet)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(plain.Buffer()) != msg || h.Padding != p {
+				t.Fatalf("%v of %d bytes: got %q with %v", p, n, plain.Buffer(), h.Padding)
+			}
+			plain.Destroy()
+			packet.Destroy()
+		}
+	}
+}
+
+func TestUnpadBad(t *testing.T) {
+	for _, bad := range [][]byte{
+		{0, 0, 0},
+		{1, 2, 3},
+		{0x80, 0},
+	} {
+		packet := lockedBytes(t, bad)
+		if _, err := unpad(packet); err == nil {
+			t.Fatalf("%x is unpadded", bad)
+		}
+		packet.Destroy()
+	}
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/awnumar/memguard"
+
+	"ekyu.moe/soda/core"
+)
+
+// partner is a live session with someone, the program may hold several of
+// them while session is the one currently in use.
+type partner struct {
+	name    string
+	session *core.Session
+}
+
+var partners []*partner
+
+// addPartner establishes a session with a new partner, by a handshake or by
+// resuming a saved session, and switches to it.
+func addPartner(kex int) error {
+	prev := session
+
+	var err error
+	if kex == KEX_RESUME {
+		err = resumeSession()
+	} else {
+		err = handshake(kex)
+	}
+	if err != nil {
+		session = prev
+		return err
+	}
+
+	if err := applyRekeyPolicy(); err != nil {
+		session.Destroy()
+		session = prev
+		return err
+	}
+
+	var name string
+	for {
+		name, err = promptPartnerName(fmt.Sprintf("Partner %d", len(partners)+1))
+		if err != nil {
+			session.Destroy()
+			session = prev
+			return err
+		}
+		if findPartner(name) == nil {
+			break
+		}
+		perror(errors.New("the name is already taken"))
+	}
+
+	partners = append(partners, &partner{
+		name:    name,
+		session: session,
+	})
+
+	return nil
+}
+
+func findPartner(name string) *partner {
+	for _, p := range partners {
+		if p.name == name {
+			return p
+		}
+	}
+
+	return nil
+}
+
+// currentPartner returns the partner of session.
+func currentPartner() *partner {
+	for _, p := range partners {
+		if p.session == session {
+			return p
+		}
+	}
+
+	return nil
+}
+
+func switchPartner() error {
+	p, err := promptPartner()
+	if err != nil {
+		return err
+	}
+
+	session = p.session
+	informf("Now talking to %s.\n", p.name)
+
+	return nil
+}
+
+// broadcast encrypts the same plain text once for several partners.
+func broadcast() error {
+	recipients, err := promptRecipients()
+	if err != nil {
+		return err
+	}
+	if len(recipients) == 0 {
+		return errors.New("no recipients selected")
+	}
+
+	sessions := make([]*core.Session, len(recipients))
+	for i, p := range recipients {
+		sessions[i] = p.session
+	}
+
+	return encryptWith(func(packet *memguard.LockedBuffer) ([]byte, error) {
+		return core.SealBroadcast(sessions, packet)
+	})
+}
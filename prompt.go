@@ -1,27 +1,53 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"strings"
+	"time"
 
 	"ekyu.moe/base91"
 	"github.com/atotto/clipboard"
+	"github.com/awnumar/memguard"
 	survey "gopkg.in/AlecAivazis/survey.v1"
 	surveyCore "gopkg.in/AlecAivazis/survey.v1/core"
 
 	"ekyu.moe/soda/codec"
 	"ekyu.moe/soda/convey"
+	"ekyu.moe/soda/core"
 	"ekyu.moe/soda/i18n"
+	"ekyu.moe/soda/packager"
 )
 
 const (
 	CMD_ENC = iota
 	CMD_DEC
+	CMD_BROADCAST
+	CMD_ADD_PARTNER
+	CMD_SWITCH_PARTNER
+	CMD_GROUP
+	CMD_VERIFY
 	CMD_RAND
 	CMD_CLS
+	CMD_SAVE
 	CMD_EXIT
 )
 
+const (
+	GROUP_CREATE = iota
+	GROUP_SEND
+	GROUP_SHARE
+	GROUP_REMOVE
+	GROUP_LEAVE
+)
+
+const (
+	KEX_PUB = iota
+	KEX_PAKE
+	KEX_RESUME
+	KEX_NOISE
+)
+
 func init() {
 	surveyCore.SelectFocusIcon = ">"
 	surveyCore.HelpIcon = ""
@@ -52,6 +78,439 @@ func promptLocale() (i18n.Locale, error) {
 	}
 }
 
+func promptKeyExchange() (int, error) {
+	question := &survey.Select{
+		Message: "How do you want to exchange keys with your partner?",
+		Options: []string{"Public key", "Passphrase", "Noise handshake", "Resume a saved session"},
+		Help: `Public key: swap commitments, then public keys, and verify the session by
+voice afterwards.
+Passphrase: both of you type the same short passphrase agreed on beforehand, in
+person or by voice. Nobody in the middle can take part without knowing it.
+Noise handshake: a standard Noise_NN_25519_ChaChaPoly_SHA256 handshake, so
+your partner may use any Noise implementation. One of you starts, and the
+session is verified by voice afterwards with a longer string.
+Resume a saved session: continue a session saved earlier, from a file.`,
+	}
+
+	kex := ""
+	if err := survey.AskOne(question, &kex, nil); err != nil {
+		return -1, err
+	}
+
+	switch kex {
+	case "Passphrase":
+		return KEX_PAKE, nil
+	case "Noise handshake":
+		return KEX_NOISE, nil
+	case "Resume a saved session":
+		return KEX_RESUME, nil
+	case "Public key":
+		fallthrough
+	default:
+		return KEX_PUB, nil
+	}
+}
+
+func promptNoiseInitiator() (bool, error) {
+	question := &survey.Select{
+		Message: "Who sends the first Noise message?",
+		Options: []string{"I do", "My partner does"},
+		Help: `A Noise handshake has an initiator, who sends the first message, and a
+responder, who answers it. Agree with your partner on who is who.`,
+	}
+
+	who := ""
+	if err := survey.AskOne(question, &who, nil); err != nil {
+		return false, err
+	}
+
+	return who == "I do", nil
+}
+
+func promptHybrid() (bool, error) {
+	question := &survey.Confirm{
+		Message: "Add post-quantum protection?",
+		Help: `Adds ML-KEM-768 to the key exchange, so that a recording of this conversation
+stays safe even against a quantum computer in the future. Both of you have to
+choose the same, and each of you sends one more, much larger, packet.`,
+	}
+
+	hybrid := false
+	if err := survey.AskOne(question, &hybrid, nil); err != nil {
+		return false, err
+	}
+
+	return hybrid, nil
+}
+
+func promptSuites() ([]core.Suite, error) {
+	all := core.AllSuites()
+	options := make([]string, len(all))
+	for i, c := range all {
+		options[i] = c.String()
+	}
+	defaults := make([]string, len(core.DefaultSuites))
+	for i, c := range core.DefaultSuites {
+		defaults[i] = c.String()
+	}
+
+	question := &survey.MultiSelect{
+		Message: "Which cipher suites do you offer?",
+		Options: options,
+		Default: defaults,
+		Help: `The strongest suite offered by both of you is used. XSalsa20-Poly1305 is
+the only one older versions of soda know.`,
+	}
+
+	names := []string{}
+	if err := survey.AskOne(question, &names, survey.Required); err != nil {
+		return nil, err
+	}
+
+	suites := make([]core.Suite, 0, len(names))
+	for _, name := range names {
+		for _, c := range all {
+			if c.String() == name {
+				suites = append(suites, c)
+			}
+		}
+	}
+
+	return suites, nil
+}
+
+func promptSharedPassphrase() (*memguard.LockedBuffer, error) {
+	question := &survey.Password{
+		Message: "Please input the passphrase you agreed on with your partner",
+	}
+
+	passphrase := ""
+	if err := survey.AskOne(question, &passphrase, survey.Required); err != nil {
+		return nil, err
+	}
+
+	return memguard.NewImmutableFromBytes([]byte(passphrase))
+}
+
+func promptCreateKeyring() (bool, error) {
+	question := &survey.Confirm{
+		Message: "Create a long-term identity key?",
+		Help: `An identity key lets your partners recognize you across sessions, and lets
+you recognize them. It is stored in a keyring encrypted with a passphrase.
+Without it, you stay anonymous and every session starts from scratch.`,
+	}
+
+	create := false
+	if err := survey.AskOne(question, &create, nil); err != nil {
+		return false, err
+	}
+
+	return create, nil
+}
+
+func promptPassphrase() (*memguard.LockedBuffer, error) {
+	question := &survey.Password{
+		Message: "Please input the passphrase",
+	}
+
+	passphrase := ""
+	if err := survey.AskOne(question, &passphrase, survey.Required); err != nil {
+		return nil, err
+	}
+
+	return memguard.NewImmutableFromBytes([]byte(passphrase))
+}
+
+func promptNewPassphrase() (*memguard.LockedBuffer, error) {
+	passphrase, err := promptPassphrase()
+	if err != nil {
+		return nil, err
+	}
+
+	question := &survey.Password{
+		Message: "Please input the passphrase again",
+	}
+
+	again := ""
+	if err := survey.AskOne(question, &again, nil); err != nil {
+		passphrase.Destroy()
+		return nil, err
+	}
+
+	if equal, _ := passphrase.EqualBytes([]byte(again)); !equal {
+		passphrase.Destroy()
+		return nil, errors.New("passphrases do not match")
+	}
+
+	return passphrase, nil
+}
+
+func promptSessionPath() (string, error) {
+	question := &survey.Input{
+		Message: "Please input the path of the session file",
+		Default: "soda-session",
+	}
+
+	path := ""
+	if err := survey.AskOne(question, &path, survey.Required); err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(path), nil
+}
+
+func promptPartnerName(def string) (string, error) {
+	question := &survey.Input{
+		Message: "What do you call this partner in this session?",
+		Default: def,
+	}
+
+	name := ""
+	if err := survey.AskOne(question, &name, survey.Required); err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(name), nil
+}
+
+func promptPartner() (*partner, error) {
+	question := &survey.Select{
+		Message: "Who do you want to talk to?",
+	}
+	for _, p := range partners {
+		question.Options = append(question.Options, p.name)
+	}
+
+	name := ""
+	if err := survey.AskOne(question, &name, nil); err != nil {
+		return nil, err
+	}
+
+	if p := findPartner(name); p != nil {
+		return p, nil
+	}
+
+	return nil, errors.New("no such partner")
+}
+
+func promptRecipients() ([]*partner, error) {
+	question := &survey.MultiSelect{
+		Message: "Who do you want to send it to?",
+		Help:    "Each of them can decrypt it with their own session, without knowing who else can.",
+	}
+	for _, p := range partners {
+		question.Options = append(question.Options, p.name)
+	}
+
+	names := []string{}
+	if err := survey.AskOne(question, &names, nil); err != nil {
+		return nil, err
+	}
+
+	recipients := make([]*partner, 0, len(names))
+	for _, name := range names {
+		if p := findPartner(name); p != nil {
+			recipients = append(recipients, p)
+		}
+	}
+
+	return recipients, nil
+}
+
+func promptGroupCmd() (int, error) {
+	const (
+		create = "Create a group"
+		send   = "Encrypt for a group"
+		share  = "Send my sender key to partners"
+		remove = "Remove a member"
+		leave  = "Leave a group"
+	)
+
+	question := &survey.Select{
+		Message: "What do you want to do with groups?",
+		Options: []string{create},
+		Help: `A group message is encrypted once for everyone in the group. Each member has
+a sender key of their own, which is sent to every other member over the
+session with them, so everyone in a group must be a partner of everyone else.`,
+	}
+	if len(groups) > 0 {
+		question.Options = append(question.Options, send, share, remove, leave)
+	}
+
+	action := ""
+	if err := survey.AskOne(question, &action, nil); err != nil {
+		return -1, err
+	}
+
+	switch action {
+	case send:
+		return GROUP_SEND, nil
+	case share:
+		return GROUP_SHARE, nil
+	case remove:
+		return GROUP_REMOVE, nil
+	case leave:
+		return GROUP_LEAVE, nil
+	default:
+		return GROUP_CREATE, nil
+	}
+}
+
+func promptGroup() (*groupChat, error) {
+	question := &survey.Select{
+		Message: "Which group?",
+	}
+	for _, c := range groups {
+		question.Options = append(question.Options, c.name)
+	}
+
+	name := ""
+	if err := survey.AskOne(question, &name, nil); err != nil {
+		return nil, err
+	}
+
+	for _, c := range groups {
+		if c.name == name {
+			return c, nil
+		}
+	}
+
+	return nil, errors.New("no such group")
+}
+
+func promptGroupName(def string) (string, error) {
+	question := &survey.Input{
+		Message: "What do you call this group?",
+		Default: def,
+	}
+
+	name := ""
+	if err := survey.AskOne(question, &name, survey.Required); err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(name), nil
+}
+
+func promptGroupMember(c *groupChat) (string, error) {
+	members := c.group.Members()
+	if len(members) == 0 {
+		return "", errors.New("nobody else is in the group")
+	}
+
+	question := &survey.Select{
+		Message: "Who do you want to remove?",
+		Options: members,
+	}
+
+	name := ""
+	if err := survey.AskOne(question, &name, nil); err != nil {
+		return "", err
+	}
+
+	return name, nil
+}
+
+func promptJoinGroup() (bool, error) {
+	question := &survey.Confirm{
+		Message: "Join the group?",
+		Default: true,
+	}
+
+	join := false
+	if err := survey.AskOne(question, &join, nil); err != nil {
+		return false, err
+	}
+
+	return join, nil
+}
+
+func promptContactName() (string, error) {
+	question := &survey.Input{
+		Message: "Who is your partner? (the name to remember them by)",
+	}
+
+	name := ""
+	if err := survey.AskOne(question, &name, survey.Required); err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(name), nil
+}
+
+// newContact is the option of promptWhichContact for someone not pinned yet.
+const newContact = "(someone new)"
+
+// promptWhichContact asks which of contacts an unknown identity is meant to be,
+// returning "" for someone new.
+func promptWhichContact(contacts []string) (string, error) {
+	question := &survey.Select{
+		Message: "Which of your contacts is your partner meant to be?",
+		Options: append([]string{newContact}, contacts...),
+		Help: `If your partner is one of your contacts, they are not using the identity key
+you have pinned for them. Pick them anyway, you will then be asked whether to
+trust the new key.`,
+	}
+
+	name := ""
+	if err := survey.AskOne(question, &name, nil); err != nil {
+		return "", err
+	}
+	if name == newContact {
+		return "", nil
+	}
+
+	return name, nil
+}
+
+func promptTrustNewIdentity(name string) (bool, error) {
+	question := &survey.Confirm{
+		Message: "Trust the identity key as " + name + "?",
+		Default: false,
+		Help: `Only do so if your partner has read you their fingerprint, in person or by
+voice, and it matches.`,
+	}
+
+	trust := false
+	if err := survey.AskOne(question, &trust, nil); err != nil {
+		return false, err
+	}
+
+	return trust, nil
+}
+
+func promptAcceptNoIdentity() (bool, error) {
+	question := &survey.Confirm{
+		Message: "Go on without knowing who your partner is?",
+		Default: false,
+		Help: `Only do so if your partner has told you, in person or by voice, that they
+have no keyring. Verify the session by voice all the same.`,
+	}
+
+	accept := false
+	if err := survey.AskOne(question, &accept, nil); err != nil {
+		return false, err
+	}
+
+	return accept, nil
+}
+
+func promptTrustChangedIdentity() (bool, error) {
+	question := &survey.Confirm{
+		Message: "Trust the new identity key anyway?",
+		Default: false,
+		Help: `Only do so if your partner has told you, in person or by voice, that they
+have created a new identity key.`,
+	}
+
+	trust := false
+	if err := survey.AskOne(question, &trust, nil); err != nil {
+		return false, err
+	}
+
+	return trust, nil
+}
+
 func promptKey() (*[32]byte, error) {
 	question := &survey.Input{
 		Message: i18n.INPUT_PUB,
@@ -70,18 +529,44 @@ func promptKey() (*[32]byte, error) {
 	return &key, nil
 }
 
+func promptConfirmAuthString() (bool, error) {
+	question := &survey.Confirm{
+		Message: i18n.CONFIRM_AUTH_STRING,
+		Help:    i18n.CONFIRM_AUTH_STRING_HELP,
+	}
+
+	confirmed := false
+	if err := survey.AskOne(question, &confirmed, nil); err != nil {
+		return false, err
+	}
+
+	return confirmed, nil
+}
+
 func promptCmd() (int, error) {
 	question := &survey.Select{
 		Message: i18n.PROMPT_CMD,
 		Options: []string{
 			i18n.PROMPT_CMD_ENC,
 			i18n.PROMPT_CMD_DEC,
-			i18n.PROMPT_CMD_CLS,
-			i18n.PROMPT_CMD_RAND,
-			i18n.PROMPT_CMD_EXIT,
 		},
 		Help: i18n.PROMPT_CMD_HELP,
 	}
+	if len(partners) > 1 {
+		question.Options = append(question.Options,
+			i18n.PROMPT_CMD_BROADCAST,
+			i18n.PROMPT_CMD_SWITCH_PARTNER,
+		)
+	}
+	question.Options = append(question.Options,
+		i18n.PROMPT_CMD_GROUP,
+		i18n.PROMPT_CMD_ADD_PARTNER,
+		i18n.PROMPT_CMD_VERIFY,
+		i18n.PROMPT_CMD_CLS,
+		i18n.PROMPT_CMD_RAND,
+		i18n.PROMPT_CMD_SAVE,
+		i18n.PROMPT_CMD_EXIT,
+	)
 
 	action := ""
 	if err := survey.AskOne(question, &action, nil); err != nil {
@@ -93,10 +578,22 @@ func promptCmd() (int, error) {
 		return CMD_ENC, nil
 	case i18n.PROMPT_CMD_DEC:
 		return CMD_DEC, nil
+	case i18n.PROMPT_CMD_BROADCAST:
+		return CMD_BROADCAST, nil
+	case i18n.PROMPT_CMD_ADD_PARTNER:
+		return CMD_ADD_PARTNER, nil
+	case i18n.PROMPT_CMD_SWITCH_PARTNER:
+		return CMD_SWITCH_PARTNER, nil
+	case i18n.PROMPT_CMD_GROUP:
+		return CMD_GROUP, nil
+	case i18n.PROMPT_CMD_VERIFY:
+		return CMD_VERIFY, nil
 	case i18n.PROMPT_CMD_CLS:
 		return CMD_CLS, nil
 	case i18n.PROMPT_CMD_RAND:
 		return CMD_RAND, nil
+	case i18n.PROMPT_CMD_SAVE:
+		return CMD_SAVE, nil
 	case i18n.PROMPT_CMD_EXIT:
 		fallthrough
 	default:
@@ -132,12 +629,25 @@ func promptEncrypted() ([]byte, error) {
 }
 
 func promptOutputWriter() (convey.WriteFunc, error) {
+	return promptWriter(false)
+}
+
+// promptKeyOutputWriter is promptOutputWriter with QR codes as well, for keys
+// moved between a phone and a computer.
+func promptKeyOutputWriter() (convey.WriteFunc, error) {
+	return promptWriter(true)
+}
+
+func promptWriter(qr bool) (convey.WriteFunc, error) {
 	question := &survey.Select{
 		Message: "Please select your output method",
 		Options: []string{"Terminal", "Editor", "Clipboard"},
 		// Options: []string{i18n.PROMPT_OUTPUT_EDITOR, i18n.PROMPT_OUTPUT_TERMINAL, "Clipboard"},
 		Help: "TODO", // i18n.PROMPT_OUTPUT_HELP,
 	}
+	if qr {
+		question.Options = append(question.Options, "QR code")
+	}
 
 	writer := ""
 	if err := survey.AskOne(question, &writer, nil); err != nil {
@@ -153,6 +663,12 @@ func promptOutputWriter() (convey.WriteFunc, error) {
 			return convey.EditorWrite, nil
 		}
 		return convey.ClipboardWrite, nil
+	case "QR code":
+		path, err := promptQRSavePath()
+		if err != nil {
+			return nil, err
+		}
+		return convey.QRWrite(path), nil
 	case "Editor":
 		fallthrough
 	default:
@@ -160,37 +676,222 @@ func promptOutputWriter() (convey.WriteFunc, error) {
 	}
 }
 
+func promptExpiry() (time.Duration, error) {
+	question := &survey.Select{
+		Message: "When should the message expire?",
+		Options: []string{"Never", "In 10 minutes", "In 1 hour", "In 1 day", "In 1 week"},
+		Help:    "Your partner can't read the message after it expires. This relies on your partner's clock.",
+	}
+
+	expiry := ""
+	if err := survey.AskOne(question, &expiry, nil); err != nil {
+		return 0, err
+	}
+
+	switch expiry {
+	case "In 10 minutes":
+		return 10 * time.Minute, nil
+	case "In 1 hour":
+		return time.Hour, nil
+	case "In 1 day":
+		return 24 * time.Hour, nil
+	case "In 1 week":
+		return 7 * 24 * time.Hour, nil
+	case "Never":
+		fallthrough
+	default:
+		return 0, nil
+	}
+}
+
+func promptBurn() (bool, error) {
+	question := &survey.Confirm{
+		Message: "Burn after reading?",
+		Help:    "Your partner can only read the message on the terminal, and it is erased after a countdown.",
+	}
+
+	burn := false
+	if err := survey.AskOne(question, &burn, nil); err != nil {
+		return false, err
+	}
+
+	return burn, nil
+}
+
+func promptPadding() (packager.Padding, error) {
+	paddings := []packager.Padding{packager.PadPADME, packager.PadPowerOfTwo, packager.PadBlock, packager.PadNone}
+	options := make([]string, len(paddings))
+	for i, p := range paddings {
+		options[i] = p.String()
+	}
+
+	question := &survey.Select{
+		Message: "How should the length of the message be hidden?",
+		Options: options,
+		Default: packager.DefaultPadding.String(),
+		Help: `The message is padded before it is encrypted, so that its length tells less
+about what it says.
+PADMÉ: costs no more than 12% of the size, good for most messages.
+Power of two: hides more, but may double the size.
+Fixed blocks: pads to a multiple of 256 bytes, short messages all look the same.
+None: the exact length is visible.`,
+	}
+
+	padding := ""
+	if err := survey.AskOne(question, &padding, nil); err != nil {
+		return 0, err
+	}
+
+	for _, p := range paddings {
+		if p.String() == padding {
+			return p, nil
+		}
+	}
+
+	return packager.DefaultPadding, nil
+}
+
+func promptSign() (bool, error) {
+	question := &survey.Confirm{
+		Message: "Sign the message with your identity key?",
+		Help: `A signed message proves to anyone, not only your partner, that you have written
+it, and your partner can keep it as proof. Only sign what you are willing to
+stand behind.`,
+	}
+
+	sign := false
+	if err := survey.AskOne(question, &sign, nil); err != nil {
+		return false, err
+	}
+
+	return sign, nil
+}
+
+func promptExportSigned() (bool, error) {
+	question := &survey.Confirm{
+		Message: "Export the signed message for verification by others?",
+		Help: `The plain text is exported along with the signature, unencrypted, so that
+anyone can verify it later with "Verify a signed message".`,
+	}
+
+	export := false
+	if err := survey.AskOne(question, &export, nil); err != nil {
+		return false, err
+	}
+
+	return export, nil
+}
+
 func promptOutputCodec() (codec.EncodeFunc, error) {
+	c, err := promptCodec()
+	if err != nil {
+		return nil, err
+	}
+
+	armor, err := promptArmor()
+	if err != nil {
+		return nil, err
+	}
+	if armor {
+		return func(p []byte) string {
+			return codec.Armor(c, p)
+		}, nil
+	}
+
+	return c.Encode, nil
+}
+
+func promptCodec() (codec.Codec, error) {
+	codecs := codec.Codecs()
+	options := make([]string, len(codecs))
+	for i, c := range codecs {
+		options[i] = c.Name()
+	}
+
 	question := &survey.Select{
 		Message: "Please select your output codec",
-		Options: []string{"ASCII", "Emoji", "EmojiTag"},
-		Help:    "TODO  (like >OwJh>}A) (like 👾🍧🙆🍬🙇🌱) (like :pizza::sushi::beer:)",
+		Options: options,
+		Help:    "TODO  (like >OwJh>}A) (like 👾🍧🙆🍬🙇🌱) (like :pizza::sushi::beer:) (like soda topmost Istanbul Pluto, to be read aloud)",
 	}
 
-	encode := ""
-	if err := survey.AskOne(question, &encode, nil); err != nil {
+	name := ""
+	if err := survey.AskOne(question, &name, nil); err != nil {
 		return nil, err
 	}
 
-	switch encode {
-	case "Emoji":
-		return codec.EmojiEncode, nil
-	case "EmojiTag":
-		return codec.EmojiTagEncode, nil
-	case "ASCII":
+	if c, ok := codec.Lookup(name); ok {
+		return c, nil
+	}
+
+	return codec.Base91, nil
+}
+
+func promptArmor() (bool, error) {
+	question := &survey.Confirm{
+		Message: "Wrap it in ASCII armor?",
+		Help: `Adds BEGIN and END lines around the text and breaks it into lines, so that it
+can be picked out of an email or a forum post, quotes and all.`,
+	}
+
+	armor := false
+	if err := survey.AskOne(question, &armor, nil); err != nil {
+		return false, err
+	}
+
+	return armor, nil
+}
+
+// promptChunkBudget returns how many characters each part can have, or 0 if
+// the text is not to be split.
+func promptChunkBudget() (int, error) {
+	question := &survey.Select{
+		Message: "Split the encrypted text into parts?",
+		Options: []string{"Don't split", "160 characters (SMS)", "500 characters", "1000 characters", "4000 characters"},
+		Help: `For channels that only take so many characters at a time. The parts are
+numbered like "1/4", and your partner can paste them in any order.`,
+	}
+
+	budget := ""
+	if err := survey.AskOne(question, &budget, nil); err != nil {
+		return 0, err
+	}
+
+	switch budget {
+	case "160 characters (SMS)":
+		return 160, nil
+	case "500 characters":
+		return 500, nil
+	case "1000 characters":
+		return 1000, nil
+	case "4000 characters":
+		return 4000, nil
+	case "Don't split":
 		fallthrough
 	default:
-		return codec.Base91Encode, nil
+		return 0, nil
 	}
 }
 
 func promptInputReader() (convey.ReadFunc, error) {
+	return promptReader(false)
+}
+
+// promptKeyInputReader is promptInputReader with QR code images as well, for
+// keys moved between a phone and a computer.
+func promptKeyInputReader() (convey.ReadFunc, error) {
+	return promptReader(true)
+}
+
+func promptReader(qr bool) (convey.ReadFunc, error) {
 	question := &survey.Select{
 		Message: "Please select your input method",
 		Options: []string{"Editor", "Clipboard"},
 		// Options: []string{i18n.PROMPT_OUTPUT_EDITOR, i18n.PROMPT_OUTPUT_TERMINAL, i18n.PROMPT_OUTPUT_CLIPBOARD},
 		Help: "TODO", // i18n.PROMPT_OUTPUT_HELP,
 	}
+	if qr {
+		question.Options = append(question.Options, "QR code image")
+	}
 
 	reader := ""
 	if err := survey.AskOne(question, &reader, nil); err != nil {
@@ -204,9 +905,42 @@ func promptInputReader() (convey.ReadFunc, error) {
 			return convey.EditorRead, nil
 		}
 		return convey.ClipboardRead, nil
+	case "QR code image":
+		path, err := promptQRImagePath()
+		if err != nil {
+			return nil, err
+		}
+		return convey.QRRead(path), nil
 	case "Editor":
 		fallthrough
 	default:
 		return convey.EditorRead, nil
 	}
 }
+
+func promptQRSavePath() (string, error) {
+	question := &survey.Input{
+		Message: "Save it as a PNG file as well? (the path, or empty for no)",
+		Help:    "The QR code is shown on the terminal either way. A PNG file is easier to send to a phone.",
+	}
+
+	path := ""
+	if err := survey.AskOne(question, &path, nil); err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(path), nil
+}
+
+func promptQRImagePath() (string, error) {
+	question := &survey.Input{
+		Message: "Please input the path of the QR code image (PNG or JPEG)",
+	}
+
+	path := ""
+	if err := survey.AskOne(question, &path, survey.Required); err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(path), nil
+}
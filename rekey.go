@@ -0,0 +1,111 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"strconv"
+	"time"
+
+	"ekyu.moe/soda/packager"
+)
+
+// applyRekeyPolicy sets when a rekey is due, which can be overridden with
+// $SODA_REKEY_MESSAGES (a number of messages) and $SODA_REKEY_INTERVAL (a
+// duration like 30m). Zero disables either limit.
+func applyRekeyPolicy() error {
+	messages, interval, err := rekeyPolicyEnv(session.RekeyPolicy())
+	if err != nil {
+		return err
+	}
+
+	if err := session.SetRekeyPolicy(messages, interval); err != nil {
+		return errNoiseRekey
+	}
+
+	return nil
+}
+
+var errNoiseRekey = errors.New("a Noise session can't be rekeyed, unset SODA_REKEY_MESSAGES and SODA_REKEY_INTERVAL to use one")
+
+// checkNoiseRekeyPolicy refuses a rekey policy set in the environment before a
+// Noise handshake is started, as it can't be applied to the session.
+func checkNoiseRekeyPolicy() error {
+	messages, interval, err := rekeyPolicyEnv(0, 0)
+	if err != nil {
+		return err
+	}
+	if messages > 0 || interval > 0 {
+		return errNoiseRekey
+	}
+
+	return nil
+}
+
+// rekeyPolicyEnv overrides the given rekey policy with the environment.
+func rekeyPolicyEnv(messages uint64, interval time.Duration) (uint64, time.Duration, error) {
+	if v := os.Getenv("SODA_REKEY_MESSAGES"); v != "" {
+		n, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			return 0, 0, errors.New("bad SODA_REKEY_MESSAGES: " + err.Error())
+		}
+		messages = n
+	}
+	if v := os.Getenv("SODA_REKEY_INTERVAL"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return 0, 0, errors.New("bad SODA_REKEY_INTERVAL: " + err.Error())
+		}
+		interval = d
+	}
+
+	return messages, interval, nil
+}
+
+// requestRekey sends a rekey request to the partner. If it fails to go out,
+// the rekey is still due and requested again next time.
+func requestRekey() error {
+	informln("It is time to refresh the session key.")
+	informln("For the rekey request to your partner:")
+
+	payload, err := session.Rekey()
+	if err != nil {
+		return err
+	}
+
+	if err := sendControl(payload); err != nil {
+		return err
+	}
+	session.RekeySent()
+
+	return nil
+}
+
+// ackRekey replies to the partner's rekey request.
+func ackRekey() error {
+	informln("Your partner asks to refresh the session key.")
+	informln("For the reply to your partner:")
+
+	payload, err := session.AckRekey()
+	if err != nil {
+		return err
+	}
+
+	return sendControl(payload)
+}
+
+// sendControl outputs a control message for the partner.
+func sendControl(payload []byte) error {
+	// Prompt output codec
+	encode, err := promptOutputCodec()
+	if err != nil {
+		return err
+	}
+
+	// Prompt output method
+	write, err := promptOutputWriter()
+	if err != nil {
+		return err
+	}
+
+	return write([]byte(encode(packager.AttachCrc32(payload))))
+}
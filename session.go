@@ -0,0 +1,155 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"ekyu.moe/soda/core"
+	"ekyu.moe/soda/i18n"
+	"ekyu.moe/soda/vault"
+)
+
+var sessionMagic = []byte("SODASS")
+
+// saveSession exports the session into a passphrase-encrypted file and
+// destroys it. The session must not be used anymore, or the file goes stale,
+// see resumeSession.
+func saveSession() error {
+	if len(partners) > 1 {
+		return errors.New("saving is only supported with a single partner")
+	}
+
+	path, err := promptSessionPath()
+	if err != nil {
+		return err
+	}
+
+	passphrase, err := promptNewPassphrase()
+	if err != nil {
+		return err
+	}
+	defer passphrase.Destroy()
+
+	state, err := session.Export()
+	if err != nil {
+		return err
+	}
+	defer state.Destroy()
+
+	sealed, err := vault.Seal(sessionMagic, state, passphrase.Buffer())
+	if err != nil {
+		return err
+	}
+
+	if err := vault.WriteFile(path, sealed); err != nil {
+		return err
+	}
+
+	session.Destroy()
+	informf("The session has been saved to %s\n", path)
+	hintf("    It is meant to be resumed once. A stale copy never reuses keys, but it can open old messages again.\n")
+
+	return nil
+}
+
+// resumeSession imports a session saved by saveSession. It is the state that
+// keeps a stale copy from reusing keys, see core.Session.Export: an imported
+// session always seals under a fresh ratchet key pair, and waits for the
+// partner first if need be.
+//
+// The file is removed afterwards, and its digest is journaled, so that
+// resuming the same file twice on this machine is refused early. This is only
+// a convenience, the journal is not backed up with the file.
+func resumeSession() error {
+	path, err := promptSessionPath()
+	if err != nil {
+		return err
+	}
+
+	sealed, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	sum := sha256.Sum256(sealed)
+	digest := hex.EncodeToString(sum[:])
+
+	journal, err := resumeJournalPath()
+	if err != nil {
+		return err
+	}
+	if resumed, err := ioutil.ReadFile(journal); err == nil {
+		for _, line := range strings.Split(string(resumed), "\n") {
+			if line == digest {
+				return errors.New("this session file has been resumed before")
+			}
+		}
+	}
+
+	for {
+		passphrase, err := promptPassphrase()
+		if err != nil {
+			return err
+		}
+
+		state, err := vault.Open(sessionMagic, sealed, passphrase.Buffer())
+		passphrase.Destroy()
+		if err == vault.ErrBadPassphrase {
+			perror(err)
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		session, err = core.Import(state)
+		state.Destroy()
+		if err != nil {
+			return err
+		}
+
+		break
+	}
+
+	// Journal it before anything else, so that it is never resumed twice.
+	if err := os.MkdirAll(filepath.Dir(journal), 0700); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(journal, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.WriteString(digest + "\n"); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	if err := os.Remove(path); err != nil {
+		hintf("    Failed to remove %s: %s\n", path, err)
+	}
+
+	informf("\nThe session has been resumed. %s\n", i18n.AUTH_STRING)
+	printAuthString(session.AuthString())
+	if session.AwaitingPartner() {
+		hintf("    You can encrypt once you have decrypted a new message from your partner.\n")
+	}
+
+	return nil
+}
+
+func resumeJournalPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(dir, "soda", "resumed"), nil
+}
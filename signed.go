@@ -0,0 +1,94 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"errors"
+
+	"ekyu.moe/soda/codec"
+	"ekyu.moe/soda/identity"
+	"ekyu.moe/soda/packager"
+)
+
+// describeSigner names the signer of a message, by the contact book if
+// possible.
+func describeSigner(pub ed25519.PublicKey) string {
+	fingerprint := identity.Fingerprint(pub)
+	if keyring == nil {
+		return fingerprint
+	}
+
+	if name, ok := keyring.Lookup(pub); ok {
+		return name + " (" + fingerprint + ")"
+	}
+	if string(pub) == string(keyring.PublicKey()) {
+		return "you (" + fingerprint + ")"
+	}
+
+	return "an unknown identity " + fingerprint
+}
+
+// exportSigned writes out a signed message, unencrypted, so that it can be
+// verified by anyone later.
+func exportSigned(signer ed25519.PublicKey, msg, sig []byte) error {
+	informln("For the signed message:")
+	encode, err := promptOutputCodec()
+	if err != nil {
+		return err
+	}
+
+	write, err := promptOutputWriter()
+	if err != nil {
+		return err
+	}
+
+	packet := packager.AttachCrc32(identity.MarshalSigned(signer, msg, sig))
+
+	return write([]byte(encode(packet)))
+}
+
+// verifySigned verifies a signed message exported by exportSigned, which needs
+// no session.
+func verifySigned() error {
+	// Prompt input method
+	informln("For the signed message:")
+	read, err := promptInputReader()
+	if err != nil {
+		return err
+	}
+
+	// Prompt output method
+	informln("For the plain text:")
+	write, err := promptOutputWriter()
+	if err != nil {
+		return err
+	}
+
+	text, err := read()
+	if err != nil {
+		return err
+	}
+
+	// Decode packet
+	packet, err := codec.Decode(string(text))
+	if err != nil {
+		return err
+	}
+	if len(packet) <= 4 {
+		return errors.New("wrong signed message size")
+	}
+
+	// Check crc32
+	raw, ok := packager.DetachCrc32(packet)
+	if !ok {
+		return errors.New("crc32 checksum failed")
+	}
+
+	signer, msg, err := identity.ParseSigned(raw)
+	if err != nil {
+		return err
+	}
+
+	informf("The signature is valid, the message is signed by %s.\n", describeSigner(signer))
+
+	return write(msg)
+}
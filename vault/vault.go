@@ -0,0 +1,139 @@
+// Package vault encrypts local files with a passphrase, using a key derived by
+// Argon2id and secretbox.
+package vault // import "ekyu.moe/soda/vault"
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"unsafe"
+
+	"github.com/awnumar/memguard"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/nacl/secretbox"
+)
+
+const (
+	version = 1
+
+	// Argon2id parameters, per the second recommended option of RFC 9106.
+	argonTime    = 3
+	argonMemory  = 64 * 1024
+	argonThreads = 4
+
+	// The parameters are read before the vault is authenticated, so anyone who
+	// can write the file could otherwise make us spend any time or memory.
+	maxArgonTime    = 10
+	maxArgonMemory  = 1024 * 1024 // 1 GiB
+	maxArgonThreads = 16
+
+	// version + time + memory + threads + salt + nonce
+	paramsLen = 1 + 4 + 4 + 1 + 16 + 24
+)
+
+// ErrBadPassphrase is returned when a vault cannot be decrypted.
+var ErrBadPassphrase = errors.New("vault: wrong passphrase or corrupted file")
+
+// Seal encrypts plain with passphrase. magic tells different kinds of vaults
+// apart.
+//
+// Format:
+//     magic + version[1] + time[4] + memory[4] + threads[1] + salt[16] +
+//     nonce[24] + secretbox
+func Seal(magic []byte, plain *memguard.LockedBuffer, passphrase []byte) ([]byte, error) {
+	salt := make([]byte, 16)
+	nonce := new([24]byte)
+	if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+		return nil, err
+	}
+	if _, err := io.ReadFull(rand.Reader, nonce[:]); err != nil {
+		return nil, err
+	}
+
+	key, err := deriveKey(passphrase, salt, argonTime, argonMemory, argonThreads)
+	if err != nil {
+		return nil, err
+	}
+	defer key.Destroy()
+
+	buf := make([]byte, 4)
+	out := append([]byte(nil), magic...)
+	out = append(out, version)
+	binary.BigEndian.PutUint32(buf, argonTime)
+	out = append(out, buf...)
+	binary.BigEndian.PutUint32(buf, argonMemory)
+	out = append(out, buf...)
+	out = append(out, argonThreads)
+	out = append(out, salt...)
+	out = append(out, nonce[:]...)
+
+	return secretbox.Seal(out, plain.Buffer(), nonce, array32(key)), nil
+}
+
+// Open decrypts a vault sealed by Seal into locked memory.
+func Open(magic, sealed, passphrase []byte) (*memguard.LockedBuffer, error) {
+	headerLen := len(magic) + paramsLen
+	if len(sealed) <= headerLen+secretbox.Overhead || !bytes.HasPrefix(sealed, magic) {
+		return nil, errors.New("vault: bad format")
+	}
+
+	params := sealed[len(magic):]
+	if params[0] != version {
+		return nil, errors.New("vault: unsupported version")
+	}
+	time := binary.BigEndian.Uint32(params[1:5])
+	memory := binary.BigEndian.Uint32(params[5:9])
+	threads := params[9]
+	if time == 0 || threads == 0 {
+		return nil, errors.New("vault: bad format")
+	}
+	if time > maxArgonTime || memory > maxArgonMemory || threads > maxArgonThreads {
+		return nil, errors.New("vault: unsupported parameters")
+	}
+	salt := params[10:26]
+	nonce := new([24]byte)
+	copy(nonce[:], params[26:50])
+
+	key, err := deriveKey(passphrase, salt, time, memory, threads)
+	if err != nil {
+		return nil, err
+	}
+	defer key.Destroy()
+
+	plain, ok := secretbox.Open(nil, sealed[headerLen:], nonce, array32(key))
+	if !ok {
+		return nil, ErrBadPassphrase
+	}
+
+	// Wipes plain
+	return memguard.NewImmutableFromBytes(plain)
+}
+
+// WriteFile writes a vault to path with only the owner having access. A temp
+// file is written first, so that a crash never leaves a half written vault
+// behind.
+func WriteFile(path string, sealed []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+
+	tmp := path + ".tmp"
+	if err := ioutil.WriteFile(tmp, sealed, 0600); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, path)
+}
+
+func deriveKey(passphrase, salt []byte, time, memory uint32, threads uint8) (*memguard.LockedBuffer, error) {
+	return memguard.NewImmutableFromBytes(argon2.IDKey(passphrase, salt, time, memory, threads, 32))
+}
+
+func array32(b *memguard.LockedBuffer) *[32]byte {
+	return (*[32]byte)(unsafe.Pointer(&b.Buffer()[0]))
+}
@@ -0,0 +1,126 @@
+package vault
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/awnumar/memguard"
+)
+
+var magic = []byte("TEST")
+
+func seal(t *testing.T, msg string) []byte {
+	t.Helper()
+
+	plain, err := memguard.NewImmutableFromBytes([]byte(msg))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer plain.Destroy()
+
+	sealed, err := Seal(magic, plain, []byte("passphrase"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return sealed
+}
+
+func TestVault(t *testing.T) {
+	sealed := seal(t, "hello")
+
+	plain, err := Open(magic, sealed, []byte("passphrase"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer plain.Destroy()
+	if string(plain.Buffer()) != "hello" {
+		t.Fatalf("got %q", plain.Buffer())
+	}
+
+	if _, err := Open(magic, sealed, []byte("wrong")); err != ErrBadPassphrase {
+		t.Fatalf("got %v, want ErrBadPassphrase", err)
+	}
+}
+
+func TestVaultTampered(t *testing.T) {
+	sealed := seal(t, "hello")
+
+	for _, i := range []int{
+		len(magic) + 10, // salt
+		len(magic) + 26, // nonce
+		len(sealed) - 1, // secretbox
+	} {
+		tampered := append([]byte(nil), sealed...)
+		tampered[i] ^= 0x01
+		if _, err := Open(magic, tampered, []byte("passphrase")); err != ErrBadPassphrase {
+			t.Fatalf("byte %d: got %v, want ErrBadPassphrase", i, err)
+		}
+	}
+}
+
+func TestVaultBad(t *testing.T) {
+	sealed := seal(t, "hello")
+
+	if _, err := Open([]byte("FAKE"), sealed, []byte("passphrase")); err == nil {
+		t.Fatal("a vault of another kind is opened")
+	}
+	if _, err := Open(magic, sealed[:len(magic)+paramsLen+16], []byte("passphrase")); err == nil {
+		t.Fatal("a truncated vault is opened")
+	}
+
+	version := append([]byte(nil), sealed...)
+	version[len(magic)]++
+	if _, err := Open(magic, version, []byte("passphrase")); err == nil {
+		t.Fatal("an unknown version is opened")
+	}
+
+	// A time cost of zero
+	params := append([]byte(nil), sealed...)
+	copy(params[len(magic)+1:], []byte{0, 0, 0, 0})
+	if _, err := Open(magic, params, []byte("passphrase")); err == nil {
+		t.Fatal("bad parameters are accepted")
+	}
+
+	// Costs beyond the caps must be refused before any key is derived.
+	for _, tc := range []struct {
+		offset int
+		value  []byte
+	}{
+		{1, []byte{0, 0, 0, maxArgonTime + 1}},
+		{5, []byte{0xff, 0xff, 0xff, 0xff}},
+		{9, []byte{maxArgonThreads + 1}},
+	} {
+		params := append([]byte(nil), sealed...)
+		copy(params[len(magic)+tc.offset:], tc.value)
+		if _, err := Open(magic, params, []byte("passphrase")); err == nil {
+			t.Fatalf("parameters at %d beyond the caps are accepted", tc.offset)
+		}
+	}
+}
+
+func TestWriteFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "soda")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "sub", "vault")
+	if err := WriteFile(path, []byte("sealed")); err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Fatalf("got mode %v", info.Mode())
+	}
+	if _, err := os.Stat(path + ".tmp"); !os.IsNotExist(err) {
+		t.Fatal("the temp file is left behind")
+	}
+}